@@ -0,0 +1,94 @@
+package noteRouter
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"strings"
+)
+
+//拆分函数类型描述字串中的参数类型与返回值类型，可变参数函数不支持拆分
+func splitFuncType(typeString string) ([]string, []string, bool) {
+	x, err := parser.ParseExpr(typeString)
+	if err != nil {
+		return nil, nil, false
+	}
+	ft, ok := x.(*ast.FuncType)
+	if !ok {
+		return nil, nil, false
+	}
+	fieldTypes := func(list *ast.FieldList) ([]string, bool) {
+		types := make([]string, 0)
+		if list == nil {
+			return types, true
+		}
+		for _, field := range list.List {
+			if _, ok := field.Type.(*ast.Ellipsis); ok {
+				return nil, false
+			}
+			t := typeString[field.Type.Pos()-1 : field.Type.End()-1]
+			//多个参数共用一个类型时每个参数都需要记录类型
+			for i := 0; i < len(field.Names) || i == 0; i++ {
+				types = append(types, t)
+			}
+		}
+		return types, true
+	}
+	params, ok := fieldTypes(ft.Params)
+	if !ok {
+		return nil, nil, false
+	}
+	results, ok := fieldTypes(ft.Results)
+	if !ok {
+		return nil, nil, false
+	}
+	return params, results, true
+}
+
+//函数签名与Map的值类型不一致时，生成转换签名的适配函数
+//Map值类型的参数是interface{}时通过类型断言转换为处理函数的参数类型，处理函数的返回值需要可以赋值给Map值类型的返回值
+//无法生成适配函数时返回false
+func renderAdapter(valueType string, fn *funcType) (string, bool) {
+	if named, ok := namedFuncList[valueType]; ok {
+		valueType = named
+	}
+	wantParams, wantResults, ok := splitFuncType(valueType)
+	if !ok {
+		return "", false
+	}
+	params, results, ok := splitFuncType(fn.typeString)
+	if !ok || len(params) != len(wantParams) || len(results) != len(wantResults) {
+		return "", false
+	}
+	args := make([]string, 0, len(params))
+	decls := make([]string, 0, len(params))
+	for i, param := range params {
+		name := fmt.Sprintf("p%d", i)
+		decls = append(decls, name+" "+wantParams[i])
+		switch {
+		case param == wantParams[i]:
+			args = append(args, name)
+		case wantParams[i] == "interface{}":
+			args = append(args, name+".("+param+")")
+		default:
+			return "", false
+		}
+	}
+	for i, result := range results {
+		if result != wantResults[i] && wantResults[i] != "interface{}" {
+			return "", false
+		}
+	}
+	call := fmt.Sprintf("%s(%s)", fn.funcName, strings.Join(args, ", "))
+	if len(results) > 0 {
+		call = "return " + call
+	}
+	resultList := strings.Join(wantResults, ", ")
+	if len(wantResults) > 1 {
+		resultList = "(" + resultList + ")"
+	}
+	if resultList != "" {
+		resultList += " "
+	}
+	return fmt.Sprintf("func(%s) %s{ %s }", strings.Join(decls, ", "), resultList, call), true
+}
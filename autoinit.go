@@ -0,0 +1,13 @@
+//go:build !noterouter_noinit
+
+package noteRouter
+
+import "os"
+
+//导入包时自动处理当前目录下的源文件，生成了新的映射文件时退出程序，重新编译后映射生效
+//只调用生成接口而不希望导入包时产生任何操作时，使用 noterouter_noinit 编译标签编译，如 go build -tags noterouter_noinit
+func init() {
+	if bWritten, _ := WorkOn("."); bWritten {
+		os.Exit(0)
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !noterouter_noinit
+
+package main
+
+//没有使用 noterouter_noinit 编译标签编译，导入noteRouter包时会按默认选项自动处理当前目录
+const noInit = false
@@ -0,0 +1,69 @@
+//noterouter 命令行工具，在 go:generate 中生成映射文件，程序不需要为了生成映射而导入noteRouter包
+//用法：//go:generate noterouter -dir . -out NodeRouterAutomation.go
+//需要使用 noterouter_noinit 编译标签编译，如 go install -tags noterouter_noinit github.com/ranqd/nodeRouter/cmd/noterouter@latest
+//使用 -dry-run 时只将生成的映射代码输出到标准输出，不写入文件，处理过程中报告了错误时以非0状态退出
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	noteRouter "github.com/ranqd/nodeRouter"
+)
+
+func main() {
+	//没有编译标签时导入包的init函数已经按默认选项处理了当前目录，不再按参数处理
+	if !noInit {
+		fmt.Fprintln(os.Stderr, "noterouter: 需要使用 noterouter_noinit 编译标签编译，如 go install -tags noterouter_noinit github.com/ranqd/nodeRouter/cmd/noterouter@latest")
+		os.Exit(2)
+	}
+	defaults := noteRouter.DefaultOptions()
+	dir := flag.String("dir", ".", "使用了注解路由的源文件所在目录")
+	out := flag.String("out", defaults.Output, "生成的映射文件名")
+	dryRun := flag.Bool("dry-run", false, "只输出生成的映射代码，不写入文件")
+	flag.Parse()
+
+	opts := defaults
+	opts.Output = *out
+	//诊断信息统一输出到标准错误，-dry-run 时标准输出只包含生成的代码
+	opts.PrintDiagnostics = false
+	os.Exit(run(*dir, opts, *dryRun))
+}
+
+//处理目录并输出结果摘要，返回进程的退出码，处理过程中报告了错误时返回1
+func run(dir string, opts noteRouter.Options, dryRun bool) int {
+	var bChanged bool
+	var err error
+	if dryRun {
+		var source string
+		source, bChanged, err = noteRouter.GenerateWith(dir, opts)
+		fmt.Print(source)
+	} else {
+		bChanged, err = noteRouter.WorkOnWith(dir, opts)
+	}
+	warnings, errs := 0, 0
+	for _, d := range noteRouter.Diagnostics() {
+		fmt.Fprintln(os.Stderr, d)
+		switch d.Severity {
+		case "Warning":
+			warnings++
+		case "Error":
+			errs++
+		}
+	}
+	//选项FailFast为false时报告错误后仍会生成有效的映射，同样以非0状态退出，使go:generate失败
+	if err != nil || errs > 0 {
+		fmt.Fprintf(os.Stderr, "noterouter: 处理 %s 失败，%d 个错误，%d 个警告\n", dir, errs, warnings)
+		return 1
+	}
+	switch {
+	case bChanged && dryRun:
+		fmt.Fprintf(os.Stderr, "noterouter: %s 的映射关系发生变化，-dry-run 没有写入文件，%d 个警告\n", dir, warnings)
+	case bChanged:
+		fmt.Fprintf(os.Stderr, "noterouter: 已更新 %s 的映射文件，%d 个警告\n", dir, warnings)
+	default:
+		fmt.Fprintf(os.Stderr, "noterouter: %s 的映射文件没有变化，%d 个警告\n", dir, warnings)
+	}
+	return 0
+}
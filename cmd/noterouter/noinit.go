@@ -0,0 +1,6 @@
+//go:build noterouter_noinit
+
+package main
+
+//使用 noterouter_noinit 编译标签编译，导入noteRouter包时不会自动处理当前目录
+const noInit = true
@@ -0,0 +1,101 @@
+package noteRouter
+
+import (
+	"fmt"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+//文件级配置指令，如 //#RouterConfig out=router_gen.go prefix=Cmd strict=true
+const routerConfigNote = "//#RouterConfig"
+
+//配置指令中的一项配置
+type routerConfig struct {
+	position token.Position //配置指令位置
+	key      string         //配置名
+	value    string         //配置值
+}
+
+//收集的文件级配置，解析完全部文件后统一应用到生成选项
+var routerConfigs = make([]routerConfig, 0)
+
+//配置项对应的选项，只在选项仍为默认值时使用配置的值，调用接口时指定的选项优先
+var routerConfigKeys = map[string]func(value string, defaults Options) error{
+	//生成的映射文件名
+	"out": func(value string, defaults Options) error {
+		if options.Output == defaults.Output {
+			options.Output = value
+		}
+		return nil
+	},
+	//名称映射去除的常量名前缀
+	"prefix": func(value string, defaults Options) error {
+		if options.NamePrefix == defaults.NamePrefix {
+			options.NamePrefix = value
+		}
+		return nil
+	},
+	//要求#Router映射的函数都是导出的
+	"strict": func(value string, defaults Options) error {
+		return configBool(&options.RequireExported, defaults.RequireExported, value)
+	},
+	//生成 ValidateRoutes 函数
+	"validate": func(value string, defaults Options) error {
+		return configBool(&options.ValidateRoutes, defaults.ValidateRoutes, value)
+	},
+}
+
+//设置布尔类型的选项，选项已不是默认值时保持不变
+func configBool(field *bool, def bool, value string) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("%s 不是有效的布尔值", value)
+	}
+	if *field == def {
+		*field = b
+	}
+	return nil
+}
+
+//是否是文件级配置指令
+func isRouterConfig(text string) bool {
+	upper := strings.ToUpper(text)
+	prefix := strings.ToUpper(routerConfigNote)
+	return upper == prefix || strings.HasPrefix(upper, prefix+" ")
+}
+
+//解析文件级配置指令，记录其中的每一项配置
+func parseRouterConfig(text string, position token.Position) {
+	for _, field := range strings.Fields(text[len(routerConfigNote):]) {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || key == "" {
+			report(severityWarning, position, "#RouterConfig 配置 %s 格式错误，应为 名称=值", field)
+			continue
+		}
+		routerConfigs = append(routerConfigs, routerConfig{position: position, key: strings.ToLower(key), value: value})
+	}
+}
+
+//将文件级配置应用到生成选项，同一配置在多处指定了不同的值时使用先出现的配置
+func applyRouterConfigs() {
+	defaults := DefaultOptions()
+	applied := make(map[string]routerConfig)
+	for _, config := range routerConfigs {
+		apply, ok := routerConfigKeys[config.key]
+		if !ok {
+			report(severityWarning, config.position, "#RouterConfig 未知的配置 %s", config.key)
+			continue
+		}
+		if first, ok := applied[config.key]; ok {
+			if first.value != config.value {
+				report(severityWarning, config.position, "#RouterConfig 配置 %s=%s 与 %s:%d 处的 %s=%s 不一致，使用先出现的配置", config.key, config.value, first.position.Filename, first.position.Line, first.key, first.value)
+			}
+			continue
+		}
+		applied[config.key] = config
+		if err := apply(config.value, defaults); err != nil {
+			report(severityWarning, config.position, "#RouterConfig 配置 %s 无效：%s", config.key, err.Error())
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package noteRouter
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go/token"
+	"os"
+	"sort"
+)
+
+//诊断信息级别
+type severity int
+
+const (
+	severityError severity = iota
+	severityWarning
+	severityNote
+)
+
+func (s severity) String() string {
+	switch s {
+	case severityError:
+		return "Error"
+	case severityWarning:
+		return "Warning"
+	}
+	return "Note"
+}
+
+//诊断信息
+type diagnostic struct {
+	position token.Position //诊断信息对应的位置，与具体位置无关时为空
+	severity severity       //级别
+	message  string         //内容
+}
+
+func (d diagnostic) String() string {
+	return formatDiagnostic(d.severity.String(), d.position.Filename, d.position.Line, d.message)
+}
+
+//格式化诊断信息，如 Warning: a.go:5 内容
+func formatDiagnostic(severity, file string, line int, message string) string {
+	if file == "" {
+		return fmt.Sprintf("%s: %s", severity, message)
+	}
+	if line == 0 {
+		return fmt.Sprintf("%s: %s %s", severity, file, message)
+	}
+	return fmt.Sprintf("%s: %s:%d %s", severity, file, line, message)
+}
+
+//导出的诊断信息，通过 Diagnostics 获取
+type Diagnostic struct {
+	File     string `json:"file"`     //文件名，与具体位置无关时为空
+	Line     int    `json:"line"`     //行号，与具体行无关时为0
+	Severity string `json:"severity"` //级别，Error、Warning 或 Note
+	Message  string `json:"message"`  //内容
+}
+
+func (d Diagnostic) String() string {
+	return formatDiagnostic(d.Severity, d.File, d.Line, d.Message)
+}
+
+//收集的诊断信息，处理结束后统一排序输出
+var diagnostics = make([]diagnostic, 0)
+
+//最近一次处理已输出的全部诊断信息，用于生成接口返回错误与 Diagnostics
+var reportedDiagnostics = make([]diagnostic, 0)
+
+//记录诊断信息
+func report(sev severity, position token.Position, format string, args ...interface{}) {
+	diagnostics = append(diagnostics, diagnostic{
+		position: position,
+		severity: sev,
+		message:  fmt.Sprintf(format, args...),
+	})
+}
+
+//按文件、行号、级别排序后输出收集的诊断信息并清空，选项PrintDiagnostics为false时只记录不输出
+//指定了选项DiagnosticsFile时同时将本次处理已输出的全部诊断信息写入文件
+func flushDiagnostics() {
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i], diagnostics[j]
+		if a.position.Filename != b.position.Filename {
+			return a.position.Filename < b.position.Filename
+		}
+		if a.position.Line != b.position.Line {
+			return a.position.Line < b.position.Line
+		}
+		return a.severity < b.severity
+	})
+	for _, d := range diagnostics {
+		if options.PrintDiagnostics {
+			fmt.Printf("%s\r\n", d)
+		}
+		reportedDiagnostics = append(reportedDiagnostics, d)
+	}
+	diagnostics = make([]diagnostic, 0)
+	if options.DiagnosticsFile != "" {
+		writeDiagnosticsFile(options.DiagnosticsFile)
+	}
+}
+
+//将诊断信息以JSON数组的格式写入文件，写入失败时记录警告
+func writeDiagnosticsFile(file string) {
+	data, err := json.MarshalIndent(Diagnostics(), "", "\t")
+	if err == nil {
+		err = os.WriteFile(file, data, 0666)
+	}
+	if err != nil {
+		d := diagnostic{severity: severityWarning, message: fmt.Sprintf("写入诊断信息文件 %s 失败：%s", file, err.Error())}
+		if options.PrintDiagnostics {
+			fmt.Printf("%s\r\n", d)
+		}
+		reportedDiagnostics = append(reportedDiagnostics, d)
+	}
+}
+
+//输出生成、删除映射文件等处理状态，选项PrintDiagnostics为false时不输出，处理状态不记录到诊断信息中
+func printStatus(format string, args ...interface{}) {
+	if options.PrintDiagnostics {
+		fmt.Printf(format+"\r\n", args...)
+	}
+}
+
+//清空上次处理记录的诊断信息
+func resetDiagnostics() {
+	diagnostics = make([]diagnostic, 0)
+	reportedDiagnostics = make([]diagnostic, 0)
+}
+
+//获取已输出的错误信息，没有错误时返回nil，多个错误时返回第一个错误与错误数量
+func reportedError() error {
+	errs := make([]diagnostic, 0)
+	for _, d := range reportedDiagnostics {
+		if d.severity == severityError {
+			errs = append(errs, d)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		return errors.New(errs[0].String())
+	}
+	return fmt.Errorf("%s 等 %d 个错误", errs[0], len(errs))
+}
+
+//用户调用接口，获取最近一次调用 WorkOn、WorkOnWith、WorkOnAll、WorkOnTree、Generate 或 DumpMarkdown 时报告的全部诊断信息
+//诊断信息按文件、行号、级别排序，可以用于在CI中检查是否存在警告
+func Diagnostics() []Diagnostic {
+	result := make([]Diagnostic, 0, len(reportedDiagnostics))
+	for _, d := range reportedDiagnostics {
+		result = append(result, Diagnostic{
+			File:     d.position.Filename,
+			Line:     d.position.Line,
+			Severity: d.severity.String(),
+			Message:  d.message,
+		})
+	}
+	return result
+}
@@ -0,0 +1,3 @@
+module github.com/ranqd/nodeRouter
+
+go 1.18
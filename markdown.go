@@ -0,0 +1,64 @@
+package noteRouter
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+//生成Markdown格式的映射关系文档，每条映射关系输出为表格中的一行：常量、映射目标、定义位置及#Desc说明
+func DumpMarkdown(path string) (string, error) {
+	return DumpMarkdownWith(path, DefaultOptions())
+}
+
+//使用指定的选项生成Markdown格式的映射关系文档，选项与 WorkOnWith 一致，如注解的包裹符号、排除的文件
+func DumpMarkdownWith(path string, opts Options) (string, error) {
+	options = opts
+	path = normalizePath(path)
+	Reset()
+	model, ok := resolveRoutes(path)
+	if !ok {
+		return "", fmt.Errorf("%s 没有找到有效的映射关系", path)
+	}
+	var b strings.Builder
+	writeMarkdownTable(&b, "方法映射", path, model.routes)
+	writeMarkdownTable(&b, "结构映射", path, model.mappings)
+	return b.String(), nil
+}
+
+//输出映射关系表格，每个Map输出一个表格，表格按Map第一次出现的顺序排列
+func writeMarkdownTable(b *strings.Builder, title, path string, routes []*routeInfo) {
+	maps := make([]*mapType, 0)
+	groups := make(map[*mapType][]*routeInfo)
+	for _, route := range routes {
+		if _, ok := groups[route.pMap]; !ok {
+			maps = append(maps, route.pMap)
+		}
+		groups[route.pMap] = append(groups[route.pMap], route)
+	}
+	for _, pMap := range maps {
+		writeMapTable(b, title, path, pMap, groups[pMap])
+	}
+}
+
+//输出一个Map的映射关系表格
+func writeMapTable(b *strings.Builder, title, path string, pMap *mapType, routes []*routeInfo) {
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(b, "## %s %s\n\n", title, pMap.name)
+	b.WriteString("| 常量 | 映射目标 | 位置 | 说明 |\n")
+	b.WriteString("| --- | --- | --- | --- |\n")
+	for _, route := range routes {
+		file := route.position.Filename
+		if rel, err := filepath.Rel(path, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		fmt.Fprintf(b, "| %s | %s | %s:%d | %s |\n", escapeMarkdown(route.key), route.target, file, route.position.Line, escapeMarkdown(route.desc))
+	}
+}
+
+//转义表格单元格中的特殊字符
+func escapeMarkdown(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
@@ -0,0 +1,150 @@
+package noteRouter
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDumpMarkdown(t *testing.T) {
+	dir := t.TempDir()
+	src := `package fixture
+
+type Cmd int
+
+const (
+	CmdLogin Cmd = iota
+	CmdLogout
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Desc 用户登录
+//#Router CmdLogin
+func login() {}
+
+//#Router CmdLogout
+func logout() {}
+
+//#Mapping CmdLogin
+//#Desc 登录请求
+type LoginReq struct{}
+`
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var doc string
+	var err error
+	captureOutput(t, func() {
+		doc, err = DumpMarkdown(dir)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"| CmdLogin | login | a.go:18 | 用户登录 |",
+		"| CmdLogout | logout | a.go:21 |  |",
+		"| CmdLogin | LoginReq | a.go:25 | 登录请求 |",
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("文档缺少 %q\n%s", want, doc)
+		}
+	}
+}
+
+func TestDumpMarkdownMultipleMaps(t *testing.T) {
+	dir := t.TempDir()
+	src := `package fixture
+
+type Op int
+
+const (
+	OpA Op = iota
+)
+
+type Ev int
+
+const (
+	EvA Ev = iota
+)
+
+//#RouterMap
+var ops = make(map[Op]func())
+
+//#RouterMap
+var evs = make(map[Ev]func())
+
+//#Router OpA
+func fo() {}
+
+//#Router EvA
+func fe() {}
+`
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var doc string
+	var err error
+	captureOutput(t, func() {
+		doc, err = DumpMarkdown(dir)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops, evs := strings.Index(doc, "## 方法映射 ops"), strings.Index(doc, "## 方法映射 evs")
+	if ops < 0 || evs < 0 {
+		t.Fatalf("每个Map应输出一个表格\n%s", doc)
+	}
+	if ops > evs {
+		t.Fatalf("表格应按Map的顺序输出\n%s", doc)
+	}
+	if !strings.Contains(doc[ops:evs], "| OpA | fo |") || strings.Contains(doc[ops:evs], "EvA") || !strings.Contains(doc[evs:], "| EvA | fe |") {
+		t.Errorf("映射没有输出到所属Map的表格中\n%s", doc)
+	}
+}
+
+func TestDumpMarkdownDefaultOptions(t *testing.T) {
+	dir := t.TempDir()
+	src := `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	//之前的处理使用的选项不影响文档的生成
+	opts := DefaultOptions()
+	opts.Exclude = []string{"a.go"}
+	opts.PrintDiagnostics = false
+	var doc string
+	var err error
+	captureOutput(t, func() {
+		WorkOnWith(t.TempDir(), opts)
+		doc, err = DumpMarkdown(dir)
+	})
+	if err != nil || !strings.Contains(doc, "| CmdA | fa |") {
+		t.Fatalf("DumpMarkdown 应使用默认选项 %v\n%s", err, doc)
+	}
+	//指定选项时使用指定的选项
+	captureOutput(t, func() {
+		_, err = DumpMarkdownWith(dir, opts)
+	})
+	if err == nil {
+		t.Fatalf("排除全部文件时应没有有效的映射关系")
+	}
+}
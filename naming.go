@@ -0,0 +1,59 @@
+package noteRouter
+
+import (
+	"strings"
+	"unicode"
+)
+
+//常量名称转换方式
+type NameTransform int
+
+const (
+	NameIdentity   NameTransform = iota //保持常量名不变
+	NameSnake                           //去除前缀后转换为 snake_case
+	NameKebab                           //去除前缀后转换为 kebab-case
+	NameTrimPrefix                      //只去除前缀
+)
+
+//按选项转换常量名称
+func transformName(name string) string {
+	switch options.NameTransform {
+	case NameSnake:
+		return splitWords(trimNamePrefix(name), "_")
+	case NameKebab:
+		return splitWords(trimNamePrefix(name), "-")
+	case NameTrimPrefix:
+		return trimNamePrefix(name)
+	}
+	return name
+}
+
+//去除常量名前缀，去除后为空时保持原名称
+func trimNamePrefix(name string) string {
+	trimmed := strings.TrimPrefix(name, options.NamePrefix)
+	if trimmed == "" {
+		return name
+	}
+	return trimmed
+}
+
+//按大小写拆分单词并使用sep连接，连续的大写字母视为一个单词，如 HTTPServer -> http_server
+func splitWords(name, sep string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if i > 0 && unicode.IsUpper(r) {
+			prev := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				b.WriteString(sep)
+			}
+		}
+		if r == '_' || r == '-' {
+			b.WriteString(sep)
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+	return b.String()
+}
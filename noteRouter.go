@@ -1,27 +1,79 @@
 package noteRouter
 
 import (
+	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
 	"go/token"
+	"go/types"
 	"io/fs"
-	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 //注解路由
 //原理：通过分析目标.go文件语法树生成const变量与func/struct的映射关系，并生成对应的init函数保存映射关系到map中，在需要使用路由的地方从Map中提取对应关系即可
 //使用方法：
 //函数路由：import 本包后使用//#RouterMap注释保存映射关系的Map，Map类型为map[映射常量的类型]映射目标函数类型或interface{}, 映射目标使用//#Router 常量名1 常量名2 ...
+//        Map的key类型是结构时可以使用复合字面量作为常量，如 //#Router RouteKey{"GET", "/"}
+//        也可以直接使用字符串或数值字面量作为常量，如 //#Router "health" "ping"，字面量的类型需要与Map的key类型兼容
+//        Map的key类型是其他包中的类型时使用包名限定的常量，如 //#Router pb.OpLogin，生成的代码引用该包
+//        可以定义多个#RouterMap，使用//#Router Map名称 常量名1 ... 映射到指定的Map，未指定Map名称时映射到key类型与常量一致的#RouterMap
+//        使用//#RouterMap external:包名.函数名 时映射生成对其他包中设置函数的调用，如 framework.SetHandler(Const1, f1)，包名前可以带导入路径
+//        映射目标也可以是保存函数的包级变量，如 var loginHandler = func() {}，生成 m[Const1] = loginHandler
+//        映射目标可以是方法，Map的值类型包含接收者时生成方法表达式，如 (*Controller).Handle，否则生成方法值，如 (&Controller{}).Handle
 //结构路由：import 本包后使用//#MappingMap 注释保存映射关系的Map, Map类型为map[映射常量的类型]interface{}, 映射目标结构使用//#Mapping 常量名1 常量名2 ....
+//        使用//#MappingPtr 常量名1 ... 时保存结构指针，如 mm[Const1] = &SSS{}
+//        常量之后可以指定结构的初始化字段，如 //#Mapping Const1 {Retries: 3} 生成 mm[Const1] = SSS{Retries: 3}
+//        选项ReflectNew为true时#Mapping 使用反射创建结构指针，如 mm[Const1] = reflect.New(reflect.TypeOf(SSS{})).Interface()
+//方法反向映射：使用//#RouterReverse 注释保存函数名到常量的Map, Map类型为map[string]映射常量的类型, 由#Router映射关系生成，同一函数映射了多个常量时使用第一个常量
+//结构反向映射：使用//#MappingReverse 注释保存结构名到常量的Map, Map类型为map[string]映射常量的类型, 由#Mapping映射关系生成
+//名称映射：使用//#NameMap 注释保存常量名称的Map, Map类型为map[映射常量的类型]string, 名称由#Router映射的常量名按选项转换生成
+//命令名称映射：使用//#CmdNameMap [前缀] 注释以命令名称为key的Map, Map类型为map[string]映射目标函数类型, 命令名称由#Router映射的常量名去除前缀后转换为小写生成，如 CmdLogin -> login，未指定前缀时去除常量的类型名
+//批量路由：在常量定义前使用//#RouterEach 函数名模板 [前缀]，如 //#RouterEach handle%s Cmd，将每个常量映射到去除前缀后按模板生成的函数
+//查找默认值：在Map定义前使用//#RouterFallback 默认值表达式，生成 Map名Lookup 查找函数，key 不存在时返回默认值
+//切片分派：使用//#RouterSlice 注释保存函数的切片, 切片类型为[]函数类型, 由#Router映射关系按常量值作为下标生成，常量值需要是从0开始的整数，同时生成下标与长度的编译期检查，常量值变化或超出切片长度后没有重新生成时编译失败
+//结构标签：使用//#TagMap 注释保存结构字段标签的Map, Map类型为map[映射常量的类型]map[string]string, 由#Mapping映射的结构中带标签的字段生成，字段名 -> 标签
+//请求响应结构：使用//#RequestMap 与 //#ResponseMap 注释保存请求结构与响应结构的Map, 使用//#MappingPair 常量 请求结构 响应结构 同时映射两个结构
+//多Map映射：使用//#Route Map名称:常量名 ... 同时映射到多个Map，Map名称可以是 router、mapping 或者Map的变量名，如 //#Route router:Const1 mm:Const2
+//映射优先级：使用//#Priority N 注释映射目标函数或结构，选项SortOrder为SortByPriority时生成的映射按优先级从小到大排列，未注释的映射优先级为0
+//映射说明：使用//#Desc 说明文字 注释映射目标函数或结构，说明会输出到 DumpMarkdown 生成的文档中
+//注解格式：注解标记外可以使用包裹符号，默认支持 //[#Router 常量名]，包裹符号可以通过选项AnnotationPrefix与AnnotationSuffix修改
 //特别说明：因需要分析.go源文件，修改与映射关系相关定义后需要运行一次程序生成映射代码后再次编译新的映射关系才会生效
 //提示：运行时的工作目录要是使用了注解路由的源文件所在目录，否则无法正常工作
+//提示：选项SplitOutput为true时方法映射与结构映射分别生成到 router_gen.go 与 mapping_gen.go 中，各自有独立的init函数与Hash
+//提示：选项OutputPackage与处理的包不同时生成代码使用包名限定引用，如 pkg.Const1、pkg.SSS{}，并根据ImportPath生成import，映射文件可以通过OutputDir输出到其他目录
+//提示：选项ValidateRoutes为true时生成 ValidateRoutes() error 函数，运行时检查#RouterMap中是否缺少常量的映射
+//提示：选项Mode为SwitchDispatch时不在init函数中保存方法映射，每个#RouterMap生成一个使用switch分派的函数，如 mDispatch(key Cmd) func()
+//提示：选项RouteCoverage为true时生成 RouteCoverage 变量，记录#RouterMap的key类型的常量总数（Total）与已映射的常量数量（Mapped）
+//提示：生成的文件默认使用 \n 换行，选项Newline为 \r\n 时使用Windows的换行符
+//提示：选项LazyInit为true时不生成init函数，映射关系在首次调用 ensureRoutes() 时通过sync.Once生成，函数名与变量名可以通过选项EnsureName、OnceName修改
+//提示：导入包时的init函数会自动处理当前目录，生成新的映射文件后退出程序，使用 noterouter_noinit 编译标签编译时导入包不执行任何操作，需要显式调用 WorkOn 生成映射
+//提示：WorkOn 返回是否生成了新的映射文件与处理过程中的错误，不会退出程序，可以在同一进程中处理多个目录
+//提示：WorkOnTree 分别处理目录树中的每个包，包中的注解全部移除后 WorkOn 与 WorkOnTree 会删除遗留的映射文件
+//提示：Generate 返回生成的映射代码但不写入文件，可以用于测试生成的映射关系
+//提示：也可以不导入包，使用命令行工具 cmd/noterouter 在 go:generate 中生成映射，如 //go:generate noterouter -dir . -out NodeRouterAutomation.go
+//提示：命令行工具通过 go install -tags noterouter_noinit github.com/ranqd/nodeRouter/cmd/noterouter@latest 安装，处理过程中报告了错误时以非0状态退出
+//提示：选项Adapters为true时，函数签名与#RouterMap的值类型不一致但可以转换时生成适配函数，参数通过类型断言转换
+//提示：选项TypeAssertions为true时为每个映射函数生成 var _ 值类型 = 函数 的编译期检查，函数类型不一致时编译器在函数定义处报告错误
+//提示：默认不处理 vendor 与 testdata 目录，选项Exclude可以指定其他不处理的目录或文件
+//提示：默认不处理_test.go文件，处理测试文件时其中的映射生成到单独的_test.go文件中，不会被编译到正式代码
+//提示：选项RegisterFunc指定函数名时生成泛型注册函数，所有映射关系通过 Register[K, V](m, k, v) 保存，需要将选项GoVersion设置为1.18以上
+//提示：选项GoVersion指定生成代码的目标Go版本，默认为1.17，不生成泛型代码
+//提示：文件开头可以使用//#RouterConfig 名称=值 ... 配置生成选项，如 out=router_gen.go prefix=Cmd strict=true validate=true，调用接口时指定的选项优先
+//提示：Diagnostics() 返回最近一次处理报告的全部诊断信息，包含文件、行号、级别与内容，选项PrintDiagnostics为false时不输出到标准输出
+//提示：选项DiagnosticsFile指定文件名时诊断信息同时以JSON格式写入此文件
+//提示：生成的映射默认按常量值排列，选项SortOrder可以改为按映射目标名称（SortByTarget）、源码位置（SortByPosition）或#Priority优先级（SortByPriority）排列
 type nodeType int
 
 const (
@@ -29,8 +81,28 @@ const (
 	nodeTypeRouterMap
 	nodeTypeMapping
 	nodeTypeMappingMap
+	nodeTypeNameMap
+	nodeTypeMappingReverse
+	nodeTypeDesc
+	nodeTypeRouterEach
+	nodeTypeRouterFallback
+	nodeTypeTagMap
+	nodeTypeMappingPair
+	nodeTypeRequestMap
+	nodeTypeResponseMap
+	nodeTypeRouterSlice
+	nodeTypeRoute
+	nodeTypeCmdNameMap
+	nodeTypePriority
+	nodeTypeRouterReverse
 )
 
+//go:generate指令信息
+type generateDirective struct {
+	position token.Position //指令位置
+	args     []string       //noteRouter命令之后的参数
+}
+
 //注释信息
 type nodeInfo struct {
 	file    string          //所属文件
@@ -42,6 +114,10 @@ type nodeInfo struct {
 	pRouterMap     *mapType      //Router映射Map指针
 	pMappingMap    *mapType      //Mapping映射Map指针
 	noteType nodeType    //注释类型
+	text     string      //注解内容，#Desc 注解的说明文字
+	pointer  bool        //是否是#MappingPtr 注解，结构映射生成结构指针
+	priority int         //Priority注解指定的优先级
+	init     string      //结构映射注解指定的结构初始化字段，如 {Retries: 3}，未指定时为空
 }
 
 //类型信息
@@ -51,6 +127,16 @@ type typeInfo struct {
 	constValues []string //常量定义列表
 }
 
+//记录类型的常量，每个常量只记录一次
+func (t *typeInfo) addConst(name string) {
+	for _, c := range t.constValues {
+		if c == name {
+			return
+		}
+	}
+	t.constValues = append(t.constValues, name)
+}
+
 //Map信息
 type mapType struct {
 	position   token.Position //在文件中的位置
@@ -58,6 +144,8 @@ type mapType struct {
 	pos       token.Pos //位置
 	keyType   string    //map下标类型
 	valueType string    //map值类型
+	valueStd  bool      //map值类型是否是标准库中定义的类型
+	external  bool      //是否是其他包中的设置函数，如 framework.SetHandler，映射生成函数调用，key与值的类型由编译器检查
 }
 
 //struct信息
@@ -65,15 +153,74 @@ type structType struct {
 	name string    //struct名称
 	pos  token.Pos //位置
 	position token.Position //详细位置
+	desc     string         //Desc注解的说明
+	priority int            //Priority注解指定的优先级
+	tags     []fieldTag     //带标签的字段
+}
+
+//结构字段标签
+type fieldTag struct {
+	field string //字段名称，匿名字段为类型名称
+	tag   string //标签内容，如 json:"name"
 }
 
 //函数信息
 type funcType struct {
-	bad        bool      //是否是不受支持的函数
 	funcName   string    //函数名称
+	recvType   string    //方法的接收者类型，如 *Controller，全局函数为空
+	methodType string    //方法值的类型描述字串，不包含接收者
 	typeString string    //函数类型描述字串
+	typeParams []string  //泛型函数的类型参数名称
+	signature  string    //泛型函数不包含类型参数列表的类型描述字串，用于按Map的值类型推导类型参数
 	pos        token.Pos //位置
 	position   token.Position //详细位置
+	desc       string         //Desc注解的说明
+	priority   int            //Priority注解指定的优先级
+	params     []paramInfo    //参数名称与类型，用于生成文档
+	results    []paramInfo    //返回值名称与类型，用于生成文档
+	isVar      bool           //是保存函数的包级变量，如 var loginHandler = func() {}
+	valueOf    string         //变量没有声明类型且使用函数名初始化时的函数名，类型在解析全部文件后确定
+}
+
+//函数参数或返回值信息
+type paramInfo struct {
+	name       string //名称，未命名时为空
+	typeString string //类型描述字串
+}
+
+//映射关系
+type routeInfo struct {
+	key      string         //映射常量名
+	target   string         //映射目标，函数名或结构名
+	pMap     *mapType       //保存映射关系的Map
+	pNode    *nodeInfo      //映射注释
+	position token.Position //映射目标的位置
+	desc     string         //映射目标的说明
+	pointer  bool           //结构映射保存结构指针，如 &SSS{}
+	priority int            //映射目标的优先级，选项SortOrder为SortByPriority时按优先级排列
+}
+
+//解析后的映射关系
+type routeModel struct {
+	routes   []*routeInfo   //方法映射
+	mappings []*routeInfo   //结构映射
+	sections []*codeSection //生成代码段
+	decls    []*codeDecl    //生成的init函数以外的声明
+}
+
+//生成的init函数以外的声明，如函数、变量
+type codeDecl struct {
+	position token.Position //产生此声明的注解位置，用于确定输出文件
+	code     string         //声明代码
+	imports  []string       //声明代码需要导入的包，如 "errors"
+}
+
+//生成代码段
+type codeSection struct {
+	name    string                        //代码段名称
+	routes  []*routeInfo                  //代码段包含的映射关系
+	render  func(route *routeInfo) string //生成单条映射关系的代码
+	mapping bool                          //是否属于结构映射，拆分输出时结构映射生成到单独的文件中
 }
 
 //声明排序结构
@@ -83,6 +230,38 @@ type declPos struct {
 	pNode   *nodeInfo   //注释结构，此位置是注释时保存注释结构
 	pFunc   *funcType   //函数结构，此位置是函数定义时保存函数结构
 	pStruct *structType //结构信息，此位置结构定义时保存结构信息
+	varName string      //变量名，此位置是变量声明时保存第一个变量名
+	pSlice  *mapType    //切片信息，此位置是切片变量声明时保存，key类型为int
+	consts  []string    //常量名列表，此位置是常量声明时保存声明的常量
+	constType string    //常量声明第一个常量的类型名
+	bodies  []typeBody  //interface与struct类型定义的范围，用于诊断写在类型定义内部的注解
+}
+
+//interface或struct类型定义的范围
+type typeBody struct {
+	name string    //类型名称
+	kind string    //interface 或 struct
+	pos  token.Pos //开始位置
+	end  token.Pos //结束位置
+}
+
+//常量信息
+type constInfo struct {
+	index int   //声明顺序
+	value int64 //常量值
+	known bool  //常量值是否可以计算，只计算iota与整数字面量组成的常量表达式
+}
+
+//用户定义的init函数中引用的标识符
+type initRef struct {
+	name     string         //引用的标识符名称
+	position token.Position //第一次引用的位置
+}
+
+//Map变量的初始化位置
+type mapInit struct {
+	name     string         //Map变量名称
+	position token.Position //初始化的位置
 }
 
 //按pos先后顺序排序
@@ -109,41 +288,292 @@ var mapList = make(map[string]mapType)
 //记录所有声明的struct
 var structList = make(map[string]structType)
 
+//记录所有声明的类型名称，用于检查Map的key类型是否定义
+var typeNames = make(map[string]bool)
+
 //记录所有声明的全局函数
 var funcList = make(map[string]funcType)
 
+//记录所有函数与方法的声明位置，函数名或 接收者类型.方法名 -> 全部声明的位置，用于检查映射目标是否有多个同名声明
+var funcDecls = make(map[string][]token.Position)
+
+//记录所有声明的常量，常量名 -> 常量信息
+var constList = make(map[string]constInfo)
+
+//用户定义的init函数中引用的标识符，用于诊断与生成的init函数之间的执行顺序依赖
+var initRefs = make([]initRef, 0)
+
+//记录所有Map变量的初始化，包括带初始值的声明与函数中的重新赋值，用于诊断多次初始化
+var mapInits = make([]mapInit, 0)
+
+//记录所有声明的切片变量
+var sliceList = make(map[string]mapType)
+
 //注释列表
 var nodeList = make([]nodeInfo, 0)
 
 //声明排序
 var declList = make(map[string]linesSort)
 
+//记录所有声明的函数类型，类型名称 -> 函数类型描述字串
+var namedFuncList = make(map[string]string)
+
+//当前处理文件的import列表，包引用名 -> 规范化后的包名
+var fileImports = make(map[string]string)
+
+//当前处理文件引用的标准库包，包引用名 -> 是否是标准库
+var fileStdImports = make(map[string]bool)
+
+//所有处理文件的import声明，包引用名 -> import声明，如 pb "example.com/pb"，用于生成代码的import
+var importSpecs = make(map[string]string)
+
+//在不同文件中对应不同包的包引用名
+var importConflicts = make(map[string]bool)
+
+//已计算的类型描述字串，语法树节点 -> 类型描述字串
+var typeStringCache = make(map[ast.Node]string)
+
+//是否缓存类型描述字串
+var typeStringCacheEnabled = true
+
+//记录所有调用noteRouter的go:generate指令
+var generateDirectives = make([]generateDirective, 0)
+
 //当前处理包名
 var packageName string
 
+//UTF-8 BOM
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+//处理的文件包名不一致
+var errPackageMismatch = errors.New("处理的包名不一致，多个包引用了NoteRouter吗")
+
+//用户调用接口，清空上次处理的解析状态与诊断信息
+//WorkOn、WorkOnWith、WorkOnAll 与 DumpMarkdown、DumpMarkdownWith 开始处理时会自动调用，多次调用或处理多个目录时互不影响
+func Reset() {
+	resetState()
+	resetDiagnostics()
+}
+
+//清空解析状态
+func resetState() {
+	typeList = make([]*typeInfo, 0)
+	mapList = make(map[string]mapType)
+	sliceList = make(map[string]mapType)
+	structList = make(map[string]structType)
+	typeNames = make(map[string]bool)
+	funcList = make(map[string]funcType)
+	funcDecls = make(map[string][]token.Position)
+	constList = make(map[string]constInfo)
+	initRefs = make([]initRef, 0)
+	mapInits = make([]mapInit, 0)
+	namedFuncList = make(map[string]string)
+	nodeList = make([]nodeInfo, 0)
+	declList = make(map[string]linesSort)
+	generateDirectives = make([]generateDirective, 0)
+	routerConfigs = make([]routerConfig, 0)
+	fileImports = make(map[string]string)
+	fileStdImports = make(map[string]bool)
+	importSpecs = make(map[string]string)
+	importConflicts = make(map[string]bool)
+	typeStringCache = make(map[ast.Node]string)
+	packageName = ""
+}
+
+//解析注解中的常量名称，常量名之间可以使用任意空白字符分隔，包括全角空格
+//复合字面量常量中的空白字符不作为分隔符，如 RouteKey{"GET", "/"}
+func parseKeys(text string) []string {
+	b := make([]string, 0)
+	depth := 0
+	var quote rune
+	start := -1
+	runes := []rune(text)
+	for i, r := range runes {
+		switch {
+		case quote != 0:
+			if r == quote && runes[i-1] != '\\' {
+				quote = 0
+			}
+		case r == '"' || r == '`' || r == '\'':
+			quote = r
+		case r == '{' || r == '(' || r == '[':
+			depth++
+		case r == '}' || r == ')' || r == ']':
+			depth--
+		case unicode.IsSpace(r) && depth <= 0:
+			if start >= 0 {
+				b = append(b, string(runes[start:i]))
+				start = -1
+			}
+			continue
+		}
+		if start < 0 {
+			start = i
+		}
+	}
+	if start >= 0 {
+		b = append(b, string(runes[start:]))
+	}
+	if len(b) < 2 {
+		return make([]string, 0)
+	}
+	return b[1:]
+}
+
+//记录文件的import列表，标准库包统一使用包名引用，别名引用不影响类型比较
+func parserImports(f *ast.File) {
+	fileImports = make(map[string]string)
+	fileStdImports = make(map[string]bool)
+	for _, imp := range f.Imports {
+		importPath := strings.Trim(imp.Path.Value, "\"`")
+		name := importPath[strings.LastIndex(importPath, "/")+1:]
+		if imp.Name != nil {
+			if imp.Name.Name == "_" || imp.Name.Name == "." {
+				continue
+			}
+			fileStdImports[imp.Name.Name] = isStdPackage(importPath)
+			//非标准库包的实际包名无法确定，保持原引用名
+			if isStdPackage(importPath) {
+				fileImports[imp.Name.Name] = name
+				recordImport(name, strconv.Quote(importPath))
+			} else {
+				fileImports[imp.Name.Name] = imp.Name.Name
+				recordImport(imp.Name.Name, imp.Name.Name+" "+strconv.Quote(importPath))
+			}
+			continue
+		}
+		fileImports[name] = name
+		fileStdImports[name] = isStdPackage(importPath)
+		recordImport(name, strconv.Quote(importPath))
+	}
+}
+
+//记录包引用名对应的import声明，同一引用名在不同文件中对应不同的包时使用先出现的声明
+//标准库包统一使用包名引用，与类型描述字串中的包名一致
+func recordImport(name, spec string) {
+	if exist, ok := importSpecs[name]; ok {
+		importConflicts[name] = importConflicts[name] || exist != spec
+		return
+	}
+	importSpecs[name] = spec
+}
+
+//收集生成代码中引用的其他包，返回对应的import声明
+//包引用名来自处理的源文件，与处理的包中声明的标识符同名时不作为包引用
+func referencedImports(source string) []string {
+	f, err := parser.ParseFile(token.NewFileSet(), "", source, 0)
+	if err != nil {
+		return nil
+	}
+	specs := make([]string, 0)
+	ast.Inspect(f, func(n ast.Node) bool {
+		x, ok := n.(*ast.SelectorExpr)
+		if !ok {
+			return true
+		}
+		pkg, ok := x.X.(*ast.Ident)
+		if !ok || pkg.Obj != nil || isPackageIdent(pkg.Name) || (crossPackage() && pkg.Name == packageName) {
+			return true
+		}
+		if spec, ok := importSpecs[pkg.Name]; ok {
+			if importConflicts[pkg.Name] {
+				report(severityWarning, token.Position{}, "包引用名 %s 在不同的文件中对应不同的包，生成的代码使用 %s", pkg.Name, spec)
+				importConflicts[pkg.Name] = false
+			}
+			specs = append(specs, spec)
+		}
+		return true
+	})
+	return specs
+}
+
+//类型是否是标准库中定义的类型，如 io.Writer
+func isStdType(n ast.Expr) bool {
+	x, ok := n.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := x.X.(*ast.Ident)
+	return ok && fileStdImports[pkg.Name]
+}
+
+//是否是标准库包，标准库包路径的第一段不包含"."
+func isStdPackage(importPath string) bool {
+	return !strings.Contains(strings.Split(importPath, "/")[0], ".")
+}
+
 
 func parserFile(file string) error {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	//去除文件开头的UTF-8 BOM
+	src = bytes.TrimPrefix(src, utf8BOM)
 	fSet := token.NewFileSet()
-	f, err := parser.ParseFile(fSet, file, nil, parser.ParseComments)
+	f, err := parser.ParseFile(fSet, file, src, parser.ParseComments)
 	if err != nil {
 		return err
 	}
 
 	declList[file] = make(linesSort,0)
 
-	if packageName == "" {
+	//包名只从实际的源文件获取，自动生成的文件可能保留着上次生成时的包名
+	generated := isGeneratedAST(f, fSet)
+	if packageName == "" && !generated {
 		packageName = f.Name.Name
 	}
 
 	if packageName != f.Name.Name {
-		return fmt.Errorf("处理的包名不一致，多个包引用了NoteRouter吗")
+		if generated {
+			return nil
+		}
+		return fmt.Errorf("%w，包名 %s 与 %s 不一致", errPackageMismatch, f.Name.Name, packageName)
+	}
+
+	parserImports(f)
+
+	//import声明结束的位置，文件头部的注解之后只有import声明，没有可以对应的定义
+	headerEnd := token.NoPos
+	//第一个非import声明的位置，文件级配置需要位于其之前
+	configEnd := f.End()
+	for _, decl := range f.Decls {
+		if gd, ok := decl.(*ast.GenDecl); ok && gd.Tok == token.IMPORT {
+			headerEnd = gd.End()
+		} else if decl.Pos() < configEnd {
+			configEnd = decl.Pos()
+		}
 	}
 
 	//查找注释
 	for _, cms := range f.Comments {
 		for _, cg := range cms.List {
+			//记录调用noteRouter的go:generate指令
+			if args, ok := parseGenerateDirective(cg.Text); ok {
+				generateDirectives = append(generateDirectives, generateDirective{
+					position: fSet.Position(cg.Pos()),
+					args:     args,
+				})
+				continue
+			}
+			//去除注解标记外的包裹符号，如 //[#Router Const1]
+			//去除首尾空白及 // 与 # 之间的空白，如 // #RouterMap
+			text := unwrapAnnotation(normalizeAnnotation(cg.Text))
+			//文件级配置，解析完全部文件后再应用
+			if isRouterConfig(text) {
+				if cg.Pos() > configEnd {
+					report(severityWarning, fSet.Position(cg.Pos()), "#RouterConfig 需要位于文件开头的声明之前，忽略此配置")
+				} else {
+					parseRouterConfig(text, fSet.Position(cg.Pos()))
+				}
+				continue
+			}
+			if cg.Pos() < headerEnd && strings.HasPrefix(text, "//#") {
+				report(severityWarning, fSet.Position(cg.Pos()), "注解位置无效：%s 位于import声明之前，不能对应任何定义，请移动到需要映射的定义之前", strings.Fields(text[2:])[0])
+				continue
+			}
 			//找到RouterMap定义
-			if strings.ToUpper(cg.Text) == strings.ToUpper("//#RouterMap") {
+			if strings.ToUpper(text) == strings.ToUpper("//#RouterMap") {
 				nodeInfo := nodeInfo{
 					pos:      cg.Pos(),
 					position: fSet.Position(cg.Pos()),
@@ -157,13 +587,99 @@ func parserFile(file string) error {
 					pNode: &nodeInfo,
 				}
 				declList[file] = append(declList[file], declInfo)
+			} else if isExternalMap(text) { //找到其他包中的设置函数，#RouterMap external:包名.函数名
+				setter := parseExternalMap(text, fSet.Position(cg.Pos()))
+				if setter == nil {
+					continue
+				}
+				nodeInfo := nodeInfo{
+					pos:        cg.Pos(),
+					position:   fSet.Position(cg.Pos()),
+					file:       file,
+					noteType:   nodeTypeRouterMap,
+					pRouterMap: setter,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if strings.ToUpper(text) == strings.ToUpper("//#RouterReverse") { //找到RouterReverse定义
+				nodeInfo := nodeInfo{
+					position: fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeRouterReverse,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if strings.ToUpper(text) == strings.ToUpper("//#RouterSlice") { //找到按常量值下标分派的切片定义
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeRouterSlice,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#RouterFallback") { //找到Map查找默认值定义，#RouterFallback 默认值表达式
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeRouterFallback,
+					text:     strings.TrimSpace(text[len("//#RouterFallback"):]),
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#RouterEach") { //找到按常量名生成映射的定义，#RouterEach handle%s 前缀
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeRouterEach,
+					keys:     parseKeys(text),
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
 				//找到映射定义
-			} else if strings.HasPrefix(strings.ToUpper(cg.Text), "//#ROUTER") {
+			} else if strings.HasPrefix(strings.ToUpper(text), "//#ROUTE ") { //找到多Map映射定义，#Route router:常量1 mapping:常量2
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeRoute,
+					keys:     parseKeys(text),
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#Router") {
 				//解析常量名称，支持多对一映射，不限制数量，#Router a b c d e
-				Keys := make([]string, 0)
-				b := strings.Split(cg.Text, " ")
-				if len(b) >= 2 {
-					Keys = b[1:]
+				Keys := parseKeys(text)
+				if len(Keys) == 0 {
+					report(severityWarning, fSet.Position(cg.Pos()), "#Router 注解未指定任何常量")
 				}
 				nodeInfo := nodeInfo{
 					position:  fSet.Position(cg.Pos()),
@@ -178,7 +694,7 @@ func parserFile(file string) error {
 					pNode: &nodeInfo,
 				}
 				declList[file] = append(declList[file], declInfo)
-			} else if strings.ToUpper(cg.Text) == strings.ToUpper("//#MappingMap") { //找到MappingMap定义
+			} else if strings.ToUpper(text) == strings.ToUpper("//#MappingMap") { //找到MappingMap定义
 				nodeInfo := nodeInfo{
 					position:  fSet.Position(cg.Pos()),
 					pos:      cg.Pos(),
@@ -191,18 +707,140 @@ func parserFile(file string) error {
 					pNode: &nodeInfo,
 				}
 				declList[file] = append(declList[file], declInfo)
-			} else if strings.HasPrefix(strings.ToUpper(cg.Text), "//#MAPPING") {
+			} else if hasDirective(text, "//#CmdNameMap") { //找到命令名称映射定义，#CmdNameMap [前缀]
+				nodeInfo := nodeInfo{
+					position: fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeCmdNameMap,
+					keys:     parseKeys(text),
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if strings.ToUpper(text) == strings.ToUpper("//#NameMap") { //找到NameMap定义
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeNameMap,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if strings.ToUpper(text) == strings.ToUpper("//#TagMap") { //找到TagMap定义
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeTagMap,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#Desc") { //找到映射目标的说明
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeDesc,
+					text:     strings.TrimSpace(text[len("//#Desc"):]),
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#Priority") { //找到映射目标的优先级
+				priority, err := strconv.Atoi(strings.TrimSpace(text[len("//#Priority"):]))
+				if err != nil {
+					report(severityWarning, fSet.Position(cg.Pos()), "#Priority 优先级 %s 不是有效的整数", strings.TrimSpace(text[len("//#Priority"):]))
+					continue
+				}
+				if options.SortOrder != SortByPriority {
+					report(severityWarning, fSet.Position(cg.Pos()), "#Priority 只在选项SortOrder为SortByPriority时生效")
+				}
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypePriority,
+					priority: priority,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if strings.ToUpper(text) == strings.ToUpper("//#MappingReverse") { //找到MappingReverse定义
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeMappingReverse,
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if strings.ToUpper(text) == strings.ToUpper("//#RequestMap") || strings.ToUpper(text) == strings.ToUpper("//#ResponseMap") { //找到请求、响应结构映射Map定义
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeRequestMap,
+				}
+				if strings.ToUpper(text) == strings.ToUpper("//#ResponseMap") {
+					nodeInfo.noteType = nodeTypeResponseMap
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#MappingPair") { //找到请求、响应结构映射，#MappingPair 常量 请求结构 响应结构
+				nodeInfo := nodeInfo{
+					position:  fSet.Position(cg.Pos()),
+					pos:      cg.Pos(),
+					noteType: nodeTypeMappingPair,
+					keys:     parseKeys(text),
+				}
+				nodeList = append(nodeList, nodeInfo)
+				//记录注释的位置
+				declInfo := &declPos{
+					pos:   cg.Pos(),
+					pNode: &nodeInfo,
+				}
+				declList[file] = append(declList[file], declInfo)
+			} else if hasDirective(text, "//#Mapping") || hasDirective(text, "//#MappingPtr") {
 				//解析常量名称，支持多对一映射，不限制数量，#Mapping a b c d e
-				Keys := make([]string, 0)
-				b := strings.Split(cg.Text, " ")
-				if len(b) >= 2 {
-					Keys = b[1:]
+				//使用 #MappingPtr a b 时映射生成结构指针
+				//可以在常量之后指定结构的初始化字段，如 #Mapping a b {Retries: 3}
+				Keys, init := splitStructInit(parseKeys(text), fSet.Position(cg.Pos()))
+				if len(Keys) == 0 {
+					report(severityWarning, fSet.Position(cg.Pos()), "#Mapping 注解未指定任何常量")
 				}
 				nodeInfo := nodeInfo{
 					position:  fSet.Position(cg.Pos()),
 					pos:      cg.Pos(),
 					noteType: nodeTypeMapping,
 					keys:     Keys,
+					pointer:  hasDirective(text, "//#MappingPtr"),
+					init:     init,
 				}
 				nodeList = append(nodeList, nodeInfo)
 				//记录注释的位置
@@ -223,13 +861,48 @@ func parserFile(file string) error {
 			declInfo := declPos{
 				pos:  gd.TokPos,
 			}
-			//记录声明的位置信息
-			declList[file] = append(declList[file], &declInfo)
-
-
-			for _, v := range gd.Specs {
-				switch x := v.(type) {
-				case *ast.TypeSpec: //类型定义，包含struct的定义
+			//记录变量名，用于诊断Map注解后的变量不是map类型
+			if gd.Tok == token.VAR && len(gd.Specs) > 0 {
+				if vs, ok := gd.Specs[0].(*ast.ValueSpec); ok && len(vs.Names) > 0 {
+					declInfo.varName = vs.Names[0].Name
+				}
+			}
+			//记录常量声明，用于#RouterEach生成映射
+			if gd.Tok == token.CONST {
+				//省略表达式的常量沿用上一个表达式
+				var values []ast.Expr
+				for i, spec := range gd.Specs {
+					vs, ok := spec.(*ast.ValueSpec)
+					if !ok {
+						continue
+					}
+					if ident, ok := vs.Type.(*ast.Ident); ok && declInfo.constType == "" && len(declInfo.consts) == 0 {
+						declInfo.constType = ident.Name
+					}
+					if len(vs.Values) > 0 {
+						values = vs.Values
+					}
+					for j, name := range vs.Names {
+						if name.Name != "_" {
+							declInfo.consts = append(declInfo.consts, name.Name)
+							//记录常量值，用于按常量值排序生成的映射
+							c := constInfo{index: len(constList)}
+							if j < len(values) {
+								c.value, c.known = evalConst(values[j], int64(i))
+							}
+							constList[name.Name] = c
+						}
+					}
+				}
+			}
+			//记录声明的位置信息
+			declList[file] = append(declList[file], &declInfo)
+
+
+			for _, v := range gd.Specs {
+				switch x := v.(type) {
+				case *ast.TypeSpec: //类型定义，包含struct的定义
+					typeNames[x.Name.Name] = true
 					switch t := x.Type.(type) {
 					case *ast.Ident: //类型定义
 						typeST = &typeInfo{
@@ -239,24 +912,39 @@ func parserFile(file string) error {
 						}
 						//记录类型定义
 						typeList = append(typeList, typeST)
+					case *ast.FuncType: //函数类型定义
+						namedFuncList[x.Name.Name] = getFuncTypeString(t)
+					case *ast.InterfaceType:
+						declInfo.bodies = append(declInfo.bodies, typeBody{name: x.Name.Name, kind: "interface", pos: t.Pos(), end: t.End()})
 					case *ast.StructType:
+						declInfo.bodies = append(declInfo.bodies, typeBody{name: x.Name.Name, kind: "struct", pos: t.Pos(), end: t.End()})
 						structInfo := structType{
 							name: x.Name.Name,
 							pos:  x.Pos(),
 							position: fSet.Position(x.Pos()),
+							tags:     getFieldTags(t),
 						}
 						//记录结构定义
 						structList[structInfo.name] = structInfo
 						declInfo.pStruct = &structInfo
 					}
 				case *ast.ValueSpec: //变量定义
+					//没有名称或者是空白标识符的变量无法在生成的代码中引用，不能作为Map或切片，常量声明的名称在下面逐个处理
+					if gd.Tok == token.VAR && (len(x.Names) == 0 || x.Names[0].Name == "_") {
+						continue
+					}
+					//保存函数的变量可以作为#Router的映射目标
+					if gd.Tok == token.VAR && declInfo.pFunc == nil {
+						declInfo.pFunc = funcVarInfo(x, fSet)
+					}
 					switch t := x.Type.(type) {
 					case *ast.Ident: //类型定义
 						if x.Names != nil && len(x.Names) > 0 {
 							//记录常量声明名称
 							for _, name := range x.Names {
-								if typeST != nil {
-									typeST.constValues = append(typeST.constValues, name.Name)
+								//空白标识符不能作为映射常量
+								if typeST != nil && name.Name != "_" {
+									typeST.addConst(name.Name)
 								}
 							}
 						}
@@ -266,10 +954,27 @@ func parserFile(file string) error {
 							name:      x.Names[0].Name,
 							keyType:   getTypeString(t.Key),
 							valueType: getTypeString(t.Value),
+							valueStd:  isStdType(t.Value),
 							pos:       v.Pos(),
 						}
 						mapList[mapInfo.name] = mapInfo
 						declInfo.pMap = &mapInfo
+						if len(x.Values) > 0 {
+							mapInits = append(mapInits, mapInit{name: mapInfo.name, position: fSet.Position(x.Names[0].Pos())})
+						}
+					case *ast.ArrayType: //切片定义
+						if t.Len == nil {
+							sliceInfo := mapType{
+								position:  fSet.Position(gd.Pos()),
+								name:      x.Names[0].Name,
+								keyType:   "int",
+								valueType: getTypeString(t.Elt),
+								valueStd:  isStdType(t.Elt),
+								pos:       v.Pos(),
+							}
+							sliceList[sliceInfo.name] = sliceInfo
+							declInfo.pSlice = &sliceInfo
+						}
 					case nil: //表达式赋值、常量定义
 						if x.Values != nil {
 							for _, vl := range x.Values {
@@ -285,10 +990,12 @@ func parserFile(file string) error {
 													name:      x.Names[0].Name,
 													keyType:   getTypeString(mt.Key),
 													valueType: getTypeString(mt.Value),
+													valueStd:  isStdType(mt.Value),
 													pos:       x.Pos(),
 												}
 												mapList[mapInfo.name] = mapInfo
 												declInfo.pMap = &mapInfo
+												mapInits = append(mapInits, mapInit{name: mapInfo.name, position: fSet.Position(x.Names[0].Pos())})
 												continue
 											}
 										}
@@ -301,8 +1008,8 @@ func parserFile(file string) error {
 							//常量定义
 							if x.Names != nil {
 								for _, name := range x.Names {
-									if typeST != nil {
-										typeST.constValues = append(typeST.constValues, name.Name)
+									if typeST != nil && name.Name != "_" {
+										typeST.addConst(name.Name)
 									}
 								}
 							}
@@ -315,62 +1022,153 @@ func parserFile(file string) error {
 			f, ok := n.(*ast.FuncDecl)
 			if ok {
 				funcInfo := funcType{
-					bad :  f.Recv != nil,//只接收全局函数定义，结构下的方法暂不支持
 					funcName:   f.Name.Name,
 					typeString: getFuncTypeString(f.Type),
 					pos:        f.Pos(),
 					position: fSet.Position(f.Pos()),
+					params:   getParams(f.Type.Params),
+					results:  getParams(f.Type.Results),
+				}
+				//方法的类型描述字串使用方法表达式的类型，接收者作为第一个参数，如 func(*Controller,int)
+				if f.Recv != nil && len(f.Recv.List) > 0 {
+					funcInfo.recvType = getTypeString(f.Recv.List[0].Type)
+					funcInfo.methodType = funcInfo.typeString
+					funcInfo.typeString = getFuncTypeString(&ast.FuncType{
+						Params:  &ast.FieldList{List: append([]*ast.Field{{Type: f.Recv.List[0].Type}}, fieldList(f.Type.Params)...)},
+						Results: f.Type.Results,
+					})
+				} else {
+					//泛型函数需要实例化后才能保存，记录类型参数用于推导
+					if f.Type.TypeParams != nil {
+						for _, field := range f.Type.TypeParams.List {
+							for _, name := range field.Names {
+								funcInfo.typeParams = append(funcInfo.typeParams, name.Name)
+							}
+						}
+						funcInfo.signature = getFuncTypeString(&ast.FuncType{Params: f.Type.Params, Results: f.Type.Results})
+					}
+					funcList[funcInfo.funcName] = funcInfo
+				}
+				//自动生成的文件中的适配函数等不会被映射
+				if !generated && f.Name.Name != "_" && f.Name.Name != "init" {
+					funcDecls[funcDeclKey(&funcInfo)] = append(funcDecls[funcDeclKey(&funcInfo)], funcInfo.position)
 				}
-				funcList[funcInfo.funcName] = funcInfo
 				declInfo := declPos{
 					pos:   f.Pos(),
 					pFunc: &funcInfo,
 				}
 				declList[file] = append(declList[file], &declInfo)
+				//记录用户定义的init函数引用的标识符，自动生成的文件除外
+				if f.Recv == nil && f.Name.Name == "init" && f.Body != nil && !generated {
+					initRefs = append(initRefs, collectInitRefs(f.Body, fSet)...)
+				}
+				//记录函数中对Map变量的重新初始化
+				if f.Body != nil && !generated {
+					mapInits = append(mapInits, collectMapInits(f.Body, fSet)...)
+				}
 			}
 		}
 	}
 	return nil
 }
 
-//获取表达式类型描述字串
+//获取表达式类型描述字串，同一语法树节点只计算一次
 func getTypeString(n ast.Expr) string {
+	if !typeStringCacheEnabled {
+		return renderTypeString(n)
+	}
+	if s, ok := typeStringCache[n]; ok {
+		return s
+	}
+	s := renderTypeString(n)
+	typeStringCache[n] = s
+	return s
+}
+
+//生成表达式类型描述字串
+func renderTypeString(n ast.Expr) string {
 	switch x := n.(type) {
 	case *ast.StarExpr:
 		//递归处理指针类型
 		return "*" + getTypeString(x.X)
 	case *ast.SelectorExpr:
+		//规范化包引用名，如 ctx.Context 与 context.Context 视为同一类型
+		if pkg, ok := x.X.(*ast.Ident); ok {
+			if name, ok := fileImports[pkg.Name]; ok {
+				return fmt.Sprintf("%s.%s", name, x.Sel)
+			}
+		}
 		return fmt.Sprintf("%s.%s", x.X, x.Sel)
 	case *ast.Ident:
 		return fmt.Sprintf("%s", x.Name)
 	case *ast.FuncType:
 		return getFuncTypeString(x)
 	case *ast.ArrayType:
-		return "[]" + getTypeString(x.Elt)
+		if x.Len == nil {
+			return "[]" + getTypeString(x.Elt)
+		}
+		//固定长度的数组，长度是字面量时使用字面量，否则使用表达式，如 [16]byte、[N]byte、[...]int
+		return "[" + getTypeString(x.Len) + "]" + getTypeString(x.Elt)
+	case *ast.BasicLit:
+		return x.Value
 	case *ast.MapType:
 		return fmt.Sprintf("map[%s]%s", getTypeString(x.Key), getTypeString(x.Value))
 	case *ast.InterfaceType:
 		return "interface{}"
 	case *ast.Ellipsis:
+		//数组字面量的长度 [...]
+		if x.Elt == nil {
+			return "..."
+		}
 		return "..." + getTypeString(x.Elt)
+	case *ast.IndexExpr:
+		//泛型类型实例，如 Req[T]
+		return fmt.Sprintf("%s[%s]", getTypeString(x.X), getTypeString(x.Index))
+	case *ast.IndexListExpr:
+		//多个类型参数的泛型类型实例，如 Pair[K,V]
+		indices := make([]string, 0, len(x.Indices))
+		for _, index := range x.Indices {
+			indices = append(indices, getTypeString(index))
+		}
+		return fmt.Sprintf("%s[%s]", getTypeString(x.X), strings.Join(indices, ","))
+	case *ast.UnaryExpr:
+		//类型约束中的近似类型，如 ~int
+		return x.Op.String() + getTypeString(x.X)
+	case *ast.BinaryExpr:
+		//类型约束中的类型并集，如 ~int|~string
+		return getTypeString(x.X) + x.Op.String() + getTypeString(x.Y)
 	}
 	return fmt.Sprintf("Unkown Type: %T, %v", n, n)
 }
 
-//获取函数类型描述字串
+//获取函数类型描述字串，泛型函数包含类型参数列表，如 func[T any](Req[T])，同一语法树节点只计算一次
 func getFuncTypeString(funcType *ast.FuncType) string {
-	params := make([]string, 0)
-	results := make([]string, 0)
-	if funcType.Params != nil {
-		for _, p := range funcType.Params.List {
-			params = append(params, getTypeString(p.Type))
-		}
+	if !typeStringCacheEnabled {
+		return renderFuncTypeString(funcType)
+	}
+	if s, ok := typeStringCache[funcType]; ok {
+		return s
 	}
-	if funcType.Results != nil {
-		for _, r := range funcType.Results.List {
-			results = append(results, getTypeString(r.Type))
+	s := renderFuncTypeString(funcType)
+	typeStringCache[funcType] = s
+	return s
+}
+
+//生成函数类型描述字串
+func renderFuncTypeString(funcType *ast.FuncType) string {
+	if funcType.TypeParams != nil && len(funcType.TypeParams.List) > 0 {
+		typeParams := make([]string, 0, len(funcType.TypeParams.List))
+		for _, field := range funcType.TypeParams.List {
+			names := make([]string, 0, len(field.Names))
+			for _, name := range field.Names {
+				names = append(names, name.Name)
+			}
+			typeParams = append(typeParams, strings.Join(names, ",")+" "+getTypeString(field.Type))
 		}
+		return "func[" + strings.Join(typeParams, ",") + "]" + strings.TrimPrefix(getFuncTypeString(&ast.FuncType{Params: funcType.Params, Results: funcType.Results}), "func")
 	}
+	params := fieldTypes(funcType.Params)
+	results := fieldTypes(funcType.Results)
 	if len(results) == 0 && len(params) == 0 {
 		return fmt.Sprintf("func()")
 	}
@@ -384,176 +1182,2896 @@ func getFuncTypeString(funcType *ast.FuncType) string {
 	return fmt.Sprintf("func(%s)(%s)", strings.Join(params, ","), strings.Join(results, ","))
 }
 
+//获取参数或返回值列表中每一项的类型描述字串，如 a, b int 作为两个 int，未命名的字段作为一项
+func fieldTypes(list *ast.FieldList) []string {
+	typeStrings := make([]string, 0)
+	for _, field := range fieldList(list) {
+		typeString := getTypeString(field.Type)
+		count := len(field.Names)
+		if count == 0 {
+			count = 1
+		}
+		for i := 0; i < count; i++ {
+			typeStrings = append(typeStrings, typeString)
+		}
+	}
+	return typeStrings
+}
+
+//字段列表中的字段，列表为空时返回nil
+func fieldList(list *ast.FieldList) []*ast.Field {
+	if list == nil {
+		return nil
+	}
+	return list.List
+}
 
-func init() {
-	WorkOn(".")
+//获取映射函数在生成代码中的引用方式，全局函数直接使用函数名
+//方法的类型与Map的值类型一致时使用方法表达式，如 (*Controller).Handle，否则接收者是结构时使用方法值，如 (&Controller{}).Handle
+//返回的函数描述中funcName为引用表达式，typeString为引用表达式的类型
+//泛型函数按Map的值类型推导类型参数并实例化，如 Handle[int]，无法推导时返回原函数
+func funcTarget(fn *funcType, valueType string) *funcType {
+	if len(fn.typeParams) > 0 {
+		return instantiate(fn, valueType)
+	}
+	if fn.recvType == "" {
+		return fn
+	}
+	target := *fn
+	recvName := strings.TrimPrefix(fn.recvType, "*")
+	if fn.recvType != recvName {
+		target.funcName = "(" + fn.recvType + ")." + fn.funcName
+	} else {
+		target.funcName = fn.recvType + "." + fn.funcName
+	}
+	if checkFuncType(valueType, fn.typeString) {
+		return &target
+	}
+	//方法值需要创建接收者，只支持结构类型的接收者
+	if _, ok := structList[recvName]; !ok {
+		return &target
+	}
+	if fn.recvType != recvName {
+		target.funcName = "(&" + recvName + "{})." + fn.funcName
+	} else {
+		target.funcName = recvName + "{}." + fn.funcName
+	}
+	target.typeString = fn.methodType
+	return &target
 }
 
-func checkConst(cType, c string) bool {
-	for _, t := range typeList {
-		if cType == t.typeName {
-			for _, con := range t.constValues {
-				if con == c {
-					return true
-				}
+//按Map的值类型推导泛型函数的类型参数，推导成功时返回实例化的函数，typeString为实例化后的类型
+func instantiate(fn *funcType, valueType string) *funcType {
+	if named, ok := namedFuncList[valueType]; ok {
+		valueType = named
+	}
+	generic, err := parser.ParseExpr(fn.signature)
+	if err != nil {
+		return fn
+	}
+	concrete, err := parser.ParseExpr(valueType)
+	if err != nil {
+		return fn
+	}
+	params := make(map[string]bool)
+	for _, name := range fn.typeParams {
+		params[name] = true
+	}
+	bindings := make(map[string]string)
+	if !unifyType(generic, concrete, params, bindings) {
+		return fn
+	}
+	args := make([]string, 0, len(fn.typeParams))
+	for _, name := range fn.typeParams {
+		arg, ok := bindings[name]
+		if !ok {
+			return fn
+		}
+		args = append(args, arg)
+	}
+	target := *fn
+	target.funcName = fn.funcName + "[" + strings.Join(args, ", ") + "]"
+	target.typeString = valueType
+	target.typeParams = nil
+	return &target
+}
+
+//比较泛型函数中的类型与Map值类型中对应的类型，类型参数的位置记录对应的类型实参，同一类型参数的实参必须一致
+func unifyType(generic, concrete ast.Expr, params map[string]bool, bindings map[string]string) bool {
+	if id, ok := generic.(*ast.Ident); ok && params[id.Name] {
+		arg := types.ExprString(concrete)
+		if bound, ok := bindings[id.Name]; ok {
+			return bound == arg
+		}
+		bindings[id.Name] = arg
+		return true
+	}
+	switch g := generic.(type) {
+	case *ast.StarExpr:
+		c, ok := concrete.(*ast.StarExpr)
+		return ok && unifyType(g.X, c.X, params, bindings)
+	case *ast.ArrayType:
+		c, ok := concrete.(*ast.ArrayType)
+		if !ok || (g.Len == nil) != (c.Len == nil) || g.Len != nil && types.ExprString(g.Len) != types.ExprString(c.Len) {
+			return false
+		}
+		return unifyType(g.Elt, c.Elt, params, bindings)
+	case *ast.MapType:
+		c, ok := concrete.(*ast.MapType)
+		return ok && unifyType(g.Key, c.Key, params, bindings) && unifyType(g.Value, c.Value, params, bindings)
+	case *ast.Ellipsis:
+		c, ok := concrete.(*ast.Ellipsis)
+		return ok && unifyType(g.Elt, c.Elt, params, bindings)
+	case *ast.IndexExpr:
+		c, ok := concrete.(*ast.IndexExpr)
+		return ok && unifyType(g.X, c.X, params, bindings) && unifyType(g.Index, c.Index, params, bindings)
+	case *ast.IndexListExpr:
+		c, ok := concrete.(*ast.IndexListExpr)
+		if !ok || len(g.Indices) != len(c.Indices) || !unifyType(g.X, c.X, params, bindings) {
+			return false
+		}
+		for i := range g.Indices {
+			if !unifyType(g.Indices[i], c.Indices[i], params, bindings) {
+				return false
 			}
+		}
+		return true
+	case *ast.FuncType:
+		c, ok := concrete.(*ast.FuncType)
+		return ok && unifyFields(g.Params, c.Params, params, bindings) && unifyFields(g.Results, c.Results, params, bindings)
+	}
+	return types.ExprString(generic) == types.ExprString(concrete)
+}
+
+//逐个比较参数或返回值列表中的类型
+func unifyFields(generic, concrete *ast.FieldList, params map[string]bool, bindings map[string]string) bool {
+	g, c := fieldList(generic), fieldList(concrete)
+	if len(g) != len(c) {
+		return false
+	}
+	for i := range g {
+		if !unifyType(g[i].Type, c[i].Type, params, bindings) {
 			return false
 		}
 	}
-	return false
+	return true
 }
 
-//用户调用接口，可指定欲处理的源文件所在目录
-func WorkOn(path string) {
-	//解析源文件
-	filepath.Walk(path, func(path string, info fs.FileInfo, err error) error {
-		parserFile(path)
+//获取函数参数或返回值的名称与类型，与getFuncTypeString不同，保留参数名称用于生成文档
+func getParams(list *ast.FieldList) []paramInfo {
+	params := make([]paramInfo, 0)
+	if list == nil {
+		return params
+	}
+	for _, field := range list.List {
+		typeString := getTypeString(field.Type)
+		if len(field.Names) == 0 {
+			params = append(params, paramInfo{typeString: typeString})
+			continue
+		}
+		for _, name := range field.Names {
+			params = append(params, paramInfo{name: name.Name, typeString: typeString})
+		}
+	}
+	return params
+}
+
+//检查函数类型是否可以保存到值类型为valueType的Map中
+func checkFuncType(valueType, funcTypeString string) bool {
+	if valueType == "interface{}" || valueType == "*interface{}" || valueType == funcTypeString {
+		return true
+	}
+	//值类型是命名的函数类型时，比较其函数签名
+	if named, ok := namedFuncList[valueType]; ok {
+		valueType = named
+	} else if named, ok := namedFuncList[funcTypeString]; ok {
+		//声明为命名函数类型的变量可以保存到值类型是相同签名的未命名函数类型的Map中
+		funcTypeString = named
+	}
+	return valueType == funcTypeString
+}
+
+//获取保存函数的包级变量信息，只处理声明单个变量的情况，如 var h = func() {}、var h func() = f、var h HandlerFunc = f、var h = f
+//变量的类型是标识符时可能不是函数类型，使用函数名初始化时需要函数的类型，都在解析全部文件后由 resolveFuncVars 确定
+func funcVarInfo(x *ast.ValueSpec, fSet *token.FileSet) *funcType {
+	if len(x.Names) != 1 || x.Names[0].Name == "_" || len(x.Values) > 1 {
 		return nil
-	})
+	}
+	fn := funcType{
+		funcName: x.Names[0].Name,
+		pos:      x.Pos(),
+		position: fSet.Position(x.Pos()),
+		isVar:    true,
+	}
+	var ft *ast.FuncType
+	switch t := x.Type.(type) {
+	case *ast.FuncType:
+		ft = t
+	case *ast.Ident:
+		fn.typeString = t.Name
+	case nil:
+		if len(x.Values) == 0 {
+			return nil
+		}
+		switch v := x.Values[0].(type) {
+		case *ast.FuncLit:
+			ft = v.Type
+		case *ast.Ident:
+			fn.valueOf = v.Name
+		default:
+			return nil
+		}
+	default:
+		return nil
+	}
+	if ft != nil {
+		fn.typeString = getFuncTypeString(ft)
+		fn.params = getParams(ft.Params)
+		fn.results = getParams(ft.Results)
+	}
+	return &fn
+}
 
-	//没有可处理的文件，不是在编译环境运行，直接返回
-	if len(declList) == 0 {
-		return
+//确定保存函数的变量的类型，类型不是函数类型或者初始化的函数未定义时不作为映射目标
+//有效的变量与函数一样记录到函数列表中，可以被#RouterEach映射
+func resolveFuncVars() {
+	files := make([]string, 0, len(declList))
+	for file := range declList {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		for _, d := range declList[file] {
+			fn := d.pFunc
+			if fn == nil || !fn.isVar {
+				continue
+			}
+			if fn.valueOf != "" {
+				target, ok := funcList[fn.valueOf]
+				if !ok || target.isVar || len(target.typeParams) > 0 {
+					d.pFunc = nil
+					continue
+				}
+				fn.typeString = target.typeString
+				fn.params = target.params
+				fn.results = target.results
+			} else if _, ok := namedFuncList[fn.typeString]; !ok && !strings.HasPrefix(fn.typeString, "func(") {
+				d.pFunc = nil
+				continue
+			}
+			funcList[fn.funcName] = *fn
+			funcDecls[fn.funcName] = append(funcDecls[fn.funcName], fn.position)
+		}
 	}
+}
 
-	bRouted := false
-	bMapped := false
+//获取类型定义的常量数量，类型未定义时返回-1
+func constCount(cType string) int {
+	for _, t := range typeList {
+		if cType == t.typeName {
+			return len(t.constValues)
+		}
+	}
+	return -1
+}
 
-	var routerMap *mapType
-	var mappingMap *mapType
+//检查Map的key类型是否已定义，key类型是未定义的标识符时每个Map只报告一次，不再逐个报告映射的常量未定义
+//预声明的类型、包中声明的类型与其他包中的类型都视为已定义
+func checkKeyType(pMap *mapType, checked map[*mapType]bool) bool {
+	keyType := pMap.keyType
+	if !token.IsIdentifier(keyType) || typeNames[keyType] || types.Universe.Lookup(keyType) != nil {
+		return true
+	}
+	if !checked[pMap] {
+		checked[pMap] = true
+		report(severityWarning, pMap.position, "Map key 类型 %s 未定义，Map %s 的映射都无法处理，请检查类型名是否拼写错误", keyType, pMap.name)
+	}
+	return false
+}
 
-	//待处理列表
-	pendingList := make([]*nodeInfo, 0)
+//注解指定的常量数量超过类型的常量数量时，必然有常量无效，提示可能的拼写错误
+func checkKeyCount(node *nodeInfo, cType string) {
+	count := constCount(cType)
+	if count >= 0 && len(node.keys) > count {
+		report(severityNote, node.position, "注解指定了 %d 个常量，但类型 %s 只定义了 %d 个常量，请检查是否存在拼写错误", len(node.keys), cType, count)
+	}
+}
 
-	for _, dList := range declList {
-		//定义排序
-		sort.Sort(dList)
-		//解析待处理列表
-		end := dList.Len()
-		for i, d := range dList {
-			if d.pNode != nil {
-				if i+1 < end {
-					switch d.pNode.noteType {
-					case nodeTypeMappingMap:
-						if dList[i+1].pMap != nil { //找到映射map
-							if mappingMap == nil {
-								d.pNode.pMappingMap = dList[i+1].pMap
-								pendingList = append(pendingList, d.pNode)
-								mappingMap = dList[i+1].pMap
-							} else {
-								fmt.Printf("Warning: %s:%d #MappingMap 重复定义， 已经定义在 %s:%d 处\r\n", d.pNode.position.Filename, d.pNode.position.Line, mappingMap.position.Filename, mappingMap.position.Line)
-							}
-						} else {
-							fmt.Printf("Warning: %s:%d #MappingMap 没有找到有效的map定义 %d\r\n", d.pNode.position.Filename, d.pNode.position.Line, dList[i+1].pos)
-						}
-					case nodeTypeRouterMap:
-						if dList[i+1].pMap != nil {
-							if routerMap == nil {
-								d.pNode.pRouterMap = dList[i+1].pMap
-								pendingList = append(pendingList, d.pNode)
-								routerMap = dList[i+1].pMap
-							} else {
-								fmt.Printf("Warning: %s:%d #RouterMap 重复定义， 已经定义在 %s:%d 处\r\n", d.pNode.position.Filename, d.pNode.position.Line, routerMap.position.Filename, routerMap.position.Line)
-							}
-						} else {
-							fmt.Printf("Warning: %s:%d #RouterMap 没有找到有效的map定义 %d\r\n", d.pNode.position.Filename, d.pNode.position.Line, dList[i+1].pos)
-						}
-					case nodeTypeRouter:
-						if dList[i+1].pFunc != nil { //找到路由目标函数
-							if dList[i+1].pFunc.bad {
-								fmt.Printf("Warning: %s:%d #Router 定义的函数不是全局函数，只能接受全局函数的定义\r\n", d.pNode.position.Filename, d.pNode.position.Line)
-							} else {
-								d.pNode.pFunc = dList[i+1].pFunc
-								pendingList = append(pendingList, d.pNode)
-								bRouted = true
-							}
-						} else {
-							fmt.Printf("Warning: %s:%d #Router 没有找到有效的函数定义\r\n", d.pNode.position.Filename, d.pNode.position.Line)
-						}
-					case nodeTypeMapping:
-						if dList[i+1].pStruct != nil { //找到结构映射目标结构
-							d.pNode.pStruct = dList[i+1].pStruct
-							pendingList = append(pendingList, d.pNode)
-							bMapped = true
-						} else {
-							fmt.Printf("Warning: %s:%d #Mapping 没有找到有效的结构定义\r\n", d.pNode.position.Filename, d.pNode.position.Line)
-						}
-					}
-				}
+//是否是复合字面量常量
+func isCompositeKey(key string) bool {
+	return strings.Contains(key, "{")
+}
+
+//检查复合字面量常量，如 RouteKey{"GET", "/"}，字面量必须能正确解析且类型与Map的key类型一致
+func checkCompositeKey(keyType, key string) bool {
+	expr, err := parser.ParseExpr(key)
+	if err != nil {
+		return false
+	}
+	lit, ok := expr.(*ast.CompositeLit)
+	if !ok || lit.Type == nil || getTypeString(lit.Type) != keyType {
+		return false
+	}
+	_, ok = structList[keyType]
+	return ok
+}
+
+//检查映射常量是否有效
+func checkKey(keyType, key string) bool {
+	if isCompositeKey(key) {
+		return checkCompositeKey(keyType, key)
+	}
+	if isQualifiedKey(keyType, key) {
+		return true
+	}
+	if isLiteralKey(key) {
+		return checkLiteralKey(keyType, key)
+	}
+	return checkConst(keyType, key)
+}
+
+//是否是字符串、数值或字符字面量，如 "health"、404
+func isLiteralKey(key string) bool {
+	_, ok := literalKind(key)
+	return ok
+}
+
+//获取字面量的类型，数值字面量可以带有负号
+func literalKind(key string) (token.Token, bool) {
+	expr, err := parser.ParseExpr(key)
+	if err != nil {
+		return token.ILLEGAL, false
+	}
+	signed := false
+	if u, ok := expr.(*ast.UnaryExpr); ok && u.Op == token.SUB {
+		expr, signed = u.X, true
+	}
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || (signed && lit.Kind != token.INT && lit.Kind != token.FLOAT) {
+		return token.ILLEGAL, false
+	}
+	return lit.Kind, true
+}
+
+//检查字面量与Map的key类型是否兼容，key类型是定义的类型时使用其底层类型
+func checkLiteralKey(keyType, key string) bool {
+	kind, _ := literalKind(key)
+	switch basic := underlyingType(keyType); kind {
+	case token.STRING:
+		return basic == "string"
+	case token.INT, token.CHAR:
+		return isIntegerType(basic) || basic == "float32" || basic == "float64"
+	case token.FLOAT:
+		return basic == "float32" || basic == "float64"
+	}
+	return false
+}
+
+//获取定义的类型的底层类型，如 type Path string 返回 string，不是定义的类型时返回原类型
+func underlyingType(typeName string) string {
+	for i := 0; i < len(typeList); i++ {
+		found := false
+		for _, t := range typeList {
+			if t.typeName == typeName && t.typeString != typeName {
+				typeName, found = t.typeString, true
+				break
 			}
 		}
+		if !found {
+			break
+		}
 	}
-	//没有需要执行的操作
-	if len(pendingList) == 0 {
-		return
+	return typeName
+}
+
+//是否是整数类型
+func isIntegerType(typeName string) bool {
+	switch typeName {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "uintptr", "byte", "rune":
+		return true
 	}
+	return false
+}
 
-	funcBody := "package " + packageName + "\r\n//NoteRouter自动生成文件，请不要随意修改!\r\n\r\nfunc init() {\r\n"
-	//生成init代码
-	if bRouted {
-		if routerMap == nil {
-			fmt.Println("Warning：#RouterMap 未定义，Router映射无法处理")
-		}else{
-			funcBody += "\t//方法映射\r\n"
-			for _, node := range pendingList {
-				if node.noteType == nodeTypeRouter {
-					for _, c := range node.keys {
-						//常量检查
-						if checkConst(routerMap.keyType, c) == false {
-							fmt.Printf("Warning: %s:%d 指定的常量 %s 未定义或者与映射Map的key类型 %s 不一致\r\n", node.position.Filename, node.position.Line, c, routerMap.keyType)
-							continue
-						}
-						//函数类型检查
-						if routerMap.valueType != node.pFunc.typeString && routerMap.valueType != "interface{}" && routerMap.valueType != "*interface{}" {
-							fmt.Printf("Error: %s:%d 定义的函数类型 【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，处理程序中断\r\n", node.pFunc.position.Filename, node.pFunc.position.Line, node.pFunc.typeString, routerMap.position.Filename,routerMap.position.Line, routerMap.name, routerMap.valueType)
-							return
-						}
-						funcBody += fmt.Sprintf("\t%s[%s] = %s\r\n", routerMap.name, c, node.pFunc.funcName)
-					}
+//是否是使用包名限定的其他包中的常量，如 pb.OpLogin，包名与Map的key类型的包名一致
+//其他包中的常量无法检查是否定义，交由编译器检查
+func isQualifiedKey(keyType, key string) bool {
+	pkg, name, ok := strings.Cut(key, ".")
+	return ok && token.IsIdentifier(pkg) && token.IsIdentifier(name) && strings.HasPrefix(keyType, pkg+".")
+}
+
+func checkConst(cType, c string) bool {
+	for _, t := range typeList {
+		if cType == t.typeName {
+			for _, con := range t.constValues {
+				if con == c {
+					return true
 				}
 			}
-			funcBody += "\t//方法映射结束\r\n"
+			return false
 		}
 	}
-	if bMapped {
-		if mappingMap == nil {
-			fmt.Println("Warning：#MappingMap 未定义，Mapping映射无法处理")
-		}else {
-			funcBody += "\r\n\t//结构映射\r\n"
-			for _, node := range pendingList {
-				if node.noteType == nodeTypeMapping {
-					for _, c := range node.keys {
-						//常量检查
-						if checkConst(mappingMap.keyType, c) == false {
-							fmt.Printf("Warning: %s:%d 指定的常量 %s 未定义或者与映射Map的key类型 %s 不一致\r\n", node.position.Filename, node.position.Line, c, mappingMap.keyType)
-							continue
-						}
-						//函数类型检查
-						if mappingMap.valueType != "interface{}" && mappingMap.valueType != "*interface{}" {
-							fmt.Printf("Error: %s:%d 定义的结构【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，处理程序中断\r\n", node.pStruct.position.Filename, node.pStruct.position.Line, node.pStruct.name, mappingMap.position.Filename, mappingMap.position.Line, mappingMap.name, mappingMap.valueType)
-							return
-						}
-						funcBody += fmt.Sprintf("\t%s[%s] = %s{}\r\n", mappingMap.name, c, node.pStruct.name)
-					}
-				}
-			}
-			funcBody += "\t//结构映射结束\r\n"
+	return false
+}
+
+//用户调用接口，可指定欲处理的源文件所在目录
+//返回是否生成了新的映射文件，处理过程中报告了错误时返回错误，生成新的映射文件后需要重新编译映射才会生效
+func WorkOn(path string) (bool, error) {
+	return WorkOnWith(path, DefaultOptions())
+}
+
+//用户调用接口，使用指定的选项处理源文件所在目录
+func WorkOnWith(path string, opts Options) (bool, error) {
+	options = opts
+	options.OutputDir = normalizePath(options.OutputDir)
+	path = normalizePath(path)
+	Reset()
+	sources, ok := generateSource(path)
+	if !ok {
+		return removeStaleSources(path), reportedError()
+	}
+	bWritten := writeSources(path, sources)
+	return bWritten, reportedError()
+}
+
+//用户调用接口，处理root目录及其子目录中的每个包，每个包含源文件的目录按 WorkOnWith 单独生成映射文件
+//不再包含注解的包中遗留的映射文件会被删除，返回是否生成或删除了映射文件，Diagnostics 返回全部包的诊断信息
+func WorkOnTree(root string, opts Options) (bool, error) {
+	root = normalizePath(root)
+	options = opts
+	dirs := make([]string, 0)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if isExcluded(root, path) || (path != root && strings.HasPrefix(d.Name(), ".")) {
+			return filepath.SkipDir
+		}
+		if hasGoSources(path) {
+			dirs = append(dirs, path)
 		}
+		return nil
+	})
+	//每个目录只处理自身的文件，子目录中同包名的文件属于其他包
+	singleDir = true
+	defer func() { singleDir = false }()
+	bWritten := false
+	collected := make([]diagnostic, 0)
+	for _, dir := range dirs {
+		bDirWritten, _ := WorkOnWith(dir, opts)
+		bWritten = bWritten || bDirWritten
+		collected = append(collected, reportedDiagnostics...)
 	}
-	funcBody += "}\r\n"
-	hashData := md5.Sum([]byte(funcBody))
-	hash := hex.EncodeToString(hashData[:])
-	funcBody += "//Hash:" + hash
-	data, err := ioutil.ReadFile(path + "\\NodeRouterAutomation.go")
-	//映射关系未发生变化，不覆写文件
-	if err == nil && strings.Index(string(data), hash) != -1 {
-		return
+	reportedDiagnostics = collected
+	if options.DiagnosticsFile != "" {
+		writeDiagnosticsFile(options.DiagnosticsFile)
 	}
-	err = ioutil.WriteFile(path + "\\NodeRouterAutomation.go", []byte(funcBody), 0777)
+	return bWritten, reportedError()
+}
+
+//只处理目录中的文件，不递归处理子目录，WorkOnTree 分别处理每个目录时使用
+var singleDir = false
+
+//目录中是否包含.go源文件，不递归处理子目录
+func hasGoSources(dir string) bool {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		fmt.Printf("Error: noteRouter生成文件失败：%s\r\n", err.Error())
-		return
+		return false
 	}
-	fmt.Printf("noteRouter 生成映射文件 NodeRouterAutomation.go 成功，请重新编译以便映射生效.\r\n")
-	os.Exit(0)
-}
\ No newline at end of file
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") {
+			return true
+		}
+	}
+	return false
+}
+
+//用户调用接口，生成映射文件的内容但不写入文件，可以用于测试生成的映射关系
+//返回与 WorkOn 写入的内容相同的映射代码，映射文件不存在或映射关系发生变化时regenerated为true，没有映射关系时返回空串
+func Generate(path string) (source string, regenerated bool, err error) {
+	return GenerateWith(path, DefaultOptions())
+}
+
+//用户调用接口，使用指定的选项生成映射文件的内容但不写入文件，只返回选项Output对应的映射文件的内容
+func GenerateWith(path string, opts Options) (source string, regenerated bool, err error) {
+	options = opts
+	options.OutputDir = normalizePath(options.OutputDir)
+	path = normalizePath(path)
+	Reset()
+	sources, ok := generateSource(path)
+	if !ok || sources[options.Output] == "" {
+		return "", false, reportedError()
+	}
+	if options.OutputDir != "" {
+		path = filepath.Join(path, options.OutputDir)
+	}
+	file := outputPath(path, options.Output)
+	source, hash := assembleSource(file, sources[options.Output])
+	flushDiagnostics()
+	data, readErr := os.ReadFile(file)
+	regenerated = readErr != nil || !strings.Contains(string(data), hash)
+	return source, regenerated, reportedError()
+}
+
+//用户调用接口，合并处理多个目录中的源文件并生成一个映射文件到output目录，所有源文件必须属于同一个包
+func WorkOnAll(output string, roots ...string) (bool, error) {
+	options = DefaultOptions()
+	output = normalizePath(output)
+	paths := make([]string, 0, len(roots))
+	for _, root := range roots {
+		paths = append(paths, normalizePath(root))
+	}
+	roots = paths
+	Reset()
+	sources, ok := generateSource(roots...)
+	if !ok {
+		return removeStaleSources(output), reportedError()
+	}
+	bWritten := writeSources(output, sources)
+	return bWritten, reportedError()
+}
+
+//统一路径中的分隔符，混用 / 与 \ 的路径如 ./sub\dir 转换为当前系统的分隔符后清理，空路径保持为空
+func normalizePath(path string) string {
+	if path == "" {
+		return path
+	}
+	return filepath.Clean(filepath.FromSlash(strings.ReplaceAll(path, "\\", "/")))
+}
+
+//生成文件的输出路径
+func outputPath(path, name string) string {
+	return filepath.Join(path, name)
+}
+
+//文件开头是否包含自动生成标记
+func isGeneratedFile(data []byte) bool {
+	lines := strings.SplitN(string(data), "\n", 4)
+	if len(lines) > 3 {
+		lines = lines[:3]
+	}
+	for _, line := range lines {
+		if strings.Contains(line, generatedMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+//是否匹配选项Exclude中的排除模式，模式与文件名或者相对于处理目录的路径匹配，处理目录本身不会被排除
+func isExcluded(root, file string) bool {
+	rel, err := filepath.Rel(root, file)
+	if err != nil || rel == "." {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+	name := filepath.Base(file)
+	for _, pattern := range options.Exclude {
+		pattern = strings.TrimSuffix(filepath.ToSlash(pattern), "/")
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+		if matched, _ := path.Match(pattern, rel); matched {
+			return true
+		}
+	}
+	return false
+}
+
+//是否是自动生成的映射文件，默认的映射文件名或者文件开头包含自动生成标记
+func isGeneratedPath(path string) bool {
+	if filepath.Base(path) == automationFile {
+		return true
+	}
+	if !strings.HasSuffix(path, ".go") {
+		return false
+	}
+	data, err := os.ReadFile(path)
+	return err == nil && isGeneratedFile(bytes.TrimPrefix(data, utf8BOM))
+}
+
+//读取处理目录中第一个不被跳过的源文件的包名，包名可以与目录名不同
+//不包含测试文件、排除的文件与自动生成的文件，没有这样的源文件时返回空串，由解析的第一个文件确定包名
+func sourcePackageName(roots []string) string {
+	for _, root := range roots {
+		entries, err := os.ReadDir(root)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			path := filepath.Join(root, entry.Name())
+			if entry.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") || isExcluded(root, path) || isGeneratedPath(path) {
+				continue
+			}
+			f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.PackageClauseOnly)
+			if err == nil {
+				return f.Name.Name
+			}
+		}
+	}
+	return ""
+}
+
+//写入生成的映射文件，映射关系未变化的文件不覆写，返回是否有文件被写入
+func writeSources(path string, sources map[string]string) bool {
+	defer flushDiagnostics()
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	//输出到指定的目录
+	if options.OutputDir != "" {
+		path = filepath.Join(path, options.OutputDir)
+		if err := os.MkdirAll(path, 0777); err != nil {
+			report(severityError, token.Position{}, "noteRouter创建输出目录失败：%s", err.Error())
+			return false
+		}
+	}
+	bWritten := false
+	for _, name := range names {
+		funcBody, hash := assembleSource(outputPath(path, name), sources[name])
+		changed := ""
+		data, err := os.ReadFile(outputPath(path, name))
+		if err == nil {
+			//映射关系未发生变化，不覆写文件
+			if strings.Index(string(data), hash) != -1 {
+				continue
+			}
+			//不覆盖非自动生成的文件
+			if !isGeneratedFile(data) {
+				report(severityError, token.Position{Filename: outputPath(path, name)}, "不是 noteRouter 自动生成的文件，拒绝覆盖，请修改输出文件名或移除该文件")
+				continue
+			}
+			checkOrphans(outputPath(path, name), data)
+			changed = changedSections(string(data), funcBody)
+		}
+		err = os.WriteFile(outputPath(path, name), []byte(funcBody), 0777)
+		if err != nil {
+			report(severityError, token.Position{}, "noteRouter生成文件失败：%s", err.Error())
+			return bWritten
+		}
+		if changed != "" {
+			printStatus("noteRouter 映射文件 %s 中%s发生变化", name, changed)
+		}
+		printStatus("noteRouter 生成映射文件 %s 成功，请重新编译以便映射生效.", name)
+		bWritten = true
+	}
+	if options.PerFile && removeOrphanOutputs(path, sources) {
+		bWritten = true
+	}
+	return bWritten
+}
+
+//包中已没有任何映射注解时删除输出目录中遗留的映射文件，避免引用已删除的映射目标导致编译失败，返回是否删除了文件
+//只删除包含自动生成标记的文件，处理过程中报告了错误或者没有可以确定包名的源文件时不做任何操作
+func removeStaleSources(path string) bool {
+	defer flushDiagnostics()
+	if packageName == "" || reportedError() != nil {
+		return false
+	}
+	if options.OutputDir != "" {
+		path = filepath.Join(path, options.OutputDir)
+	}
+	return removeGeneratedFiles(path, func(name string) bool { return false }, "已没有映射注解")
+}
+
+//删除目录中keep返回false的自动生成的映射文件，返回是否删除了文件，reason为删除的原因
+//只删除包含自动生成标记的文件，不会删除手写的文件
+func removeGeneratedFiles(path string, keep func(name string) bool, reason string) bool {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return false
+	}
+	bRemoved := false
+	for _, entry := range entries {
+		file := outputPath(path, entry.Name())
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".go") || keep(entry.Name()) {
+			continue
+		}
+		data, err := os.ReadFile(file)
+		if err != nil || !isGeneratedFile(bytes.TrimPrefix(data, utf8BOM)) {
+			continue
+		}
+		if err := os.Remove(file); err != nil {
+			report(severityError, token.Position{Filename: file}, "noteRouter删除不再需要的映射文件失败：%s", err.Error())
+			continue
+		}
+		printStatus("noteRouter %s，删除映射文件 %s，请重新编译.", reason, entry.Name())
+		bRemoved = true
+	}
+	return bRemoved
+}
+
+//按源文件分别生成时删除源文件已被删除或者已没有映射注解的映射文件，如 NodeRouterAutomation_b.go
+//只处理与本次生成的映射文件同名前缀的文件，sources中的文件保留
+func removeOrphanOutputs(path string, sources map[string]string) bool {
+	return removeGeneratedFiles(path, func(name string) bool {
+		if _, ok := sources[name]; ok {
+			return true
+		}
+		for _, output := range defaultOutputs() {
+			if strings.HasPrefix(name, strings.TrimSuffix(output, ".go")+"_") {
+				return false
+			}
+		}
+		return true
+	}, "源文件已删除或者已没有映射注解")
+}
+
+//格式化生成的代码并在末尾记录Hash，返回映射文件的内容与Hash
+//格式化失败时使用未格式化的代码，gofmt只处理\n换行的注释
+func assembleSource(file, source string) (string, string) {
+	funcBody := strings.ReplaceAll(source, "\r\n", "\n")
+	if formatted, err := format.Source([]byte(funcBody)); err != nil {
+		report(severityWarning, token.Position{Filename: file}, "格式化生成的代码失败：%s，使用未格式化的代码", err.Error())
+	} else {
+		funcBody = string(formatted)
+	}
+	//使用\r\n换行时Hash按转换后的内容计算，修改换行符后会重新生成文件
+	newline := outputNewline()
+	funcBody = strings.ReplaceAll(funcBody, "\n", newline)
+	hash := md5Hex(funcBody)
+	return funcBody + "//Hash:" + hash + newline, hash
+}
+
+//生成文件使用的换行符，选项Newline不是 \r\n 时都使用 \n
+func outputNewline() string {
+	if options.Newline == "\r\n" {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+//分段Hash的标记
+const (
+	routerHashLabel  = "RouterHash:"
+	mappingHashLabel = "MappingHash:"
+)
+
+//计算内容的md5
+func md5Hex(s string) string {
+	hashData := md5.Sum([]byte(s))
+	return hex.EncodeToString(hashData[:])
+}
+
+//获取生成文件中记录的分段Hash，没有记录时返回空串
+func sectionHash(data, label string) string {
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "//"+label) {
+			return strings.TrimPrefix(line, "//"+label)
+		}
+	}
+	return ""
+}
+
+//比较新旧文件的分段Hash，返回发生变化的部分，旧文件没有记录分段Hash时返回空串
+func changedSections(oldData, newData string) string {
+	changed := make([]string, 0)
+	for _, section := range []struct{ label, name string }{{routerHashLabel, "方法映射"}, {mappingHashLabel, "结构映射"}} {
+		oldHash := sectionHash(oldData, section.label)
+		if oldHash == "" {
+			return ""
+		}
+		if oldHash != sectionHash(newData, section.label) {
+			changed = append(changed, section.name)
+		}
+	}
+	return strings.Join(changed, "、")
+}
+
+//检查已生成的文件中引用的映射目标是否仍然存在，映射的函数或结构被删除后旧的生成文件会导致编译失败
+func checkOrphans(file string, data []byte) {
+	fSet := token.NewFileSet()
+	f, err := parser.ParseFile(fSet, file, data, 0)
+	if err != nil {
+		return
+	}
+	for _, decl := range f.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Name.Name != "init" || fd.Body == nil {
+			continue
+		}
+		for _, stmt := range fd.Body.List {
+			assign, ok := stmt.(*ast.AssignStmt)
+			if !ok || len(assign.Lhs) != 1 || len(assign.Rhs) != 1 {
+				continue
+			}
+			if _, ok := assign.Lhs[0].(*ast.IndexExpr); !ok {
+				continue
+			}
+			ident := targetIdent(assign.Rhs[0])
+			if ident == nil || isPackageIdent(ident.Name) {
+				continue
+			}
+			report(severityWarning, fSet.Position(assign.Pos()), "已删除的路由目标 %s，生成文件中的映射已失效，将在重新生成时移除", ident.Name)
+		}
+	}
+}
+
+//获取映射目标引用的标识符，映射目标为函数名或结构字面量，跨包输出时为包名限定的标识符
+//方法表达式与方法值使用接收者类型，如 (&Controller{}).Handle 中的 Controller，适配函数等其他表达式返回nil
+func targetIdent(expr ast.Expr) *ast.Ident {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return x
+	case *ast.CompositeLit:
+		return targetIdent(x.Type)
+	case *ast.ParenExpr:
+		return targetIdent(x.X)
+	case *ast.StarExpr:
+		return targetIdent(x.X)
+	case *ast.UnaryExpr:
+		return targetIdent(x.X)
+	case *ast.SelectorExpr:
+		//包名限定的标识符
+		if ident, ok := x.X.(*ast.Ident); ok && !isPackageIdent(ident.Name) {
+			return x.Sel
+		}
+		return targetIdent(x.X)
+	}
+	return nil
+}
+
+//解析源文件并生成映射代码，返回输出文件名与代码的对应关系，没有需要生成的内容或处理中断时返回false
+func generateSource(roots ...string) (map[string]string, bool) {
+	if options.Newline != "" && options.Newline != "\n" && options.Newline != "\r\n" {
+		report(severityWarning, token.Position{}, "选项Newline只能是 \\n 或 \\r\\n，使用 \\n 换行")
+	}
+	model, ok := resolveRoutes(roots...)
+	if !ok {
+		return nil, false
+	}
+	//按输出文件分组生成代码
+	groups := groupByOutput(model.sections)
+	declGroups := make(map[string][]*codeDecl)
+	for _, decl := range model.decls {
+		name := outputFor(decl.position, false)
+		declGroups[name] = append(declGroups[name], decl)
+		if _, ok := groups[name]; !ok {
+			groups[name] = nil
+		}
+	}
+	//单文件输出时总是生成文件，以便清除已失效的映射，拆分输出时两个文件总是同时生成
+	if !options.PerFile {
+		outputs := defaultOutputs()
+		bAll := len(groups) == 0
+		for _, name := range outputs {
+			if _, ok := groups[name]; ok {
+				bAll = true
+			}
+		}
+		for _, name := range outputs {
+			if _, ok := groups[name]; !ok && bAll {
+				groups[name] = nil
+			}
+		}
+	}
+	//延迟生成映射的函数只能定义一次
+	if options.LazyInit && len(groups) > 1 {
+		report(severityError, token.Position{}, "LazyInit 模式只支持生成一个映射文件，不能与 PerFile、SplitOutput 或测试文件的映射同时使用")
+		flushDiagnostics()
+		return nil, false
+	}
+	sources := make(map[string]string)
+	for name, group := range groups {
+		sources[name] = buildInitSource(group, declGroups[name])
+	}
+	return sources, true
+}
+
+//解析源文件并校验映射关系，没有需要处理的映射关系或处理中断时返回false
+func resolveRoutes(roots ...string) (*routeModel, bool) {
+	defer flushDiagnostics()
+	//包名不一致的处理方式，默认单目录时跳过，多个目录合并处理时要求所有文件属于同一个包
+	policy := options.PackageMismatchPolicy
+	if policy == PackageMismatchDefault {
+		policy = PackageMismatchSkip
+		if len(roots) > 1 {
+			policy = PackageMismatchError
+		}
+	}
+	bMismatch := false
+	//包名以处理目录中的源文件为准，不受先解析的子目录或测试文件的影响
+	packageName = sourcePackageName(roots)
+	//解析源文件
+	for _, root := range roots {
+		filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+			if singleDir && info != nil && info.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			//输出目录中的映射文件不属于处理的包
+			if options.OutputDir != "" && info != nil && info.IsDir() && filepath.Clean(path) == filepath.Join(root, options.OutputDir) {
+				return filepath.SkipDir
+			}
+			//跳过排除的目录与文件，如 vendor、testdata 中的文件属于其他包
+			if info != nil && isExcluded(root, path) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			//测试文件中的注解不参与正式代码的生成
+			if options.SkipTestFiles && strings.HasSuffix(path, "_test.go") {
+				return nil
+			}
+			//跳过自动生成的映射文件，避免重复生成时解析上次生成的结果
+			if info != nil && !info.IsDir() && isGeneratedPath(path) {
+				return nil
+			}
+			if err := parserFile(path); errors.Is(err, errPackageMismatch) {
+				switch policy {
+				case PackageMismatchWarn:
+					report(severityWarning, token.Position{Filename: path}, "%s，忽略此文件", err.Error())
+				case PackageMismatchError:
+					report(severityError, token.Position{Filename: path}, "%s", err.Error())
+					bMismatch = true
+				}
+			}
+			return nil
+		})
+	}
+	if bMismatch {
+		return nil, false
+	}
+	applyRouterConfigs()
+	resolveFuncVars()
+
+	//没有可处理的文件，不是在编译环境运行，直接返回
+	//只有自动生成的文件时没有可以确定包名的源文件
+	if len(declList) == 0 || packageName == "" {
+		return nil, false
+	}
+
+	//输出到其他包时需要导入处理的包
+	if crossPackage() && options.ImportPath == "" {
+		report(severityError, token.Position{}, "映射文件输出到包 %s 时需要指定处理的包 %s 的导入路径 ImportPath", options.OutputPackage, packageName)
+		return nil, false
+	}
+
+	bRouted := false
+	bMapped := false
+
+	var routerMap *mapType
+	routerMapNodes := make([]*nodeInfo, 0)
+	var mappingMap *mapType
+	var nameMap *mapType
+	var cmdNameMap *mapType
+	var cmdNameNode *nodeInfo
+	var mappingReverseMap *mapType
+	var routerReverseMap *mapType
+	var tagMap *mapType
+	var requestMap *mapType
+	var routerSlice *nodeInfo
+	var responseMap *mapType
+
+	//待处理列表
+	pendingList := make([]*nodeInfo, 0)
+	//Map查找默认值列表
+	fallbacks := make([]*nodeInfo, 0)
+	//请求、响应结构映射列表
+	pairs := make([]*nodeInfo, 0)
+	//多Map映射列表，所有Map定义解析完成后展开
+	compacts := make([]*nodeInfo, 0)
+
+	//按文件名顺序处理，重复定义时选择的Map与诊断信息的顺序保持稳定
+	files := make([]string, 0, len(declList))
+	for file := range declList {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		dList := declList[file]
+		//定义排序
+		sort.Sort(dList)
+		//解析待处理列表
+		for i, d := range dList {
+			if d.pNode != nil {
+				//类型定义内部的方法或字段不能作为映射目标
+				if body := enclosingBody(dList, i); body != nil {
+					if d.pNode.noteType != nodeTypeDesc && d.pNode.noteType != nodeTypePriority {
+						report(severityWarning, d.pNode.position, "注解位于 %s 类型 %s 的定义内部，只支持注释顶层的函数、结构或变量定义", body.kind, body.name)
+					}
+					continue
+				}
+				//只处理指定文件中的映射注解，其他文件中的声明仍然参与解析
+				if isRouteNote(d.pNode.noteType) && !isAnnotationFile(file) {
+					continue
+				}
+				//请求、响应结构映射直接指定映射的结构，不需要对应的声明
+				if d.pNode.noteType == nodeTypeMappingPair {
+					pairs = append(pairs, d.pNode)
+					continue
+				}
+				//其他包中的设置函数不需要对应的Map定义
+				if d.pNode.noteType == nodeTypeRouterMap && d.pNode.pRouterMap != nil {
+					pkg := strings.Split(d.pNode.pRouterMap.name, ".")[0]
+					if _, ok := importSpecs[pkg]; !ok {
+						report(severityWarning, d.pNode.position, "#RouterMap 没有找到包 %s 的导入路径，请在处理的文件中导入该包，或者使用完整的导入路径，如 external:example.com/%s", pkg, d.pNode.pRouterMap.name)
+					}
+					pendingList = append(pendingList, d.pNode)
+					routerMapNodes = append(routerMapNodes, d.pNode)
+					if routerMap == nil {
+						routerMap = d.pNode.pRouterMap
+					}
+					continue
+				}
+				if next := nextDecl(dList, i, isAuxNote(d.pNode.noteType)); next != nil {
+					switch d.pNode.noteType {
+					case nodeTypeMappingMap:
+						if next.pMap != nil { //找到映射map
+							if mappingMap == nil {
+								d.pNode.pMappingMap = next.pMap
+								pendingList = append(pendingList, d.pNode)
+								mappingMap = next.pMap
+							} else {
+								report(severityWarning, d.pNode.position, "#MappingMap 重复定义， 已经定义在 %s:%d 处", mappingMap.position.Filename, mappingMap.position.Line)
+							}
+						} else {
+							warnMapNotFound(d.pNode, next, "#MappingMap")
+						}
+					case nodeTypeRouterMap:
+						if next.pMap != nil {
+							//可以定义多个#RouterMap，第一个定义的Map作为未指定Map名称的#Router的默认Map
+							d.pNode.pRouterMap = next.pMap
+							pendingList = append(pendingList, d.pNode)
+							routerMapNodes = append(routerMapNodes, d.pNode)
+							if routerMap == nil {
+								routerMap = next.pMap
+							}
+						} else {
+							warnMapNotFound(d.pNode, next, "#RouterMap")
+						}
+					case nodeTypeNameMap:
+						if resolveMapNote(d.pNode, next, &nameMap, "#NameMap") {
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeCmdNameMap:
+						if resolveMapNote(d.pNode, next, &cmdNameMap, "#CmdNameMap") {
+							cmdNameNode = d.pNode
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeMappingReverse:
+						if resolveMapNote(d.pNode, next, &mappingReverseMap, "#MappingReverse") {
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeRouterReverse:
+						if resolveMapNote(d.pNode, next, &routerReverseMap, "#RouterReverse") {
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeTagMap:
+						if resolveMapNote(d.pNode, next, &tagMap, "#TagMap") {
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeRouterSlice:
+						if next.pSlice == nil {
+							report(severityWarning, d.pNode.position, "#RouterSlice 没有找到有效的切片定义%s", foundDecl(next))
+						} else if routerSlice != nil {
+							report(severityWarning, d.pNode.position, "#RouterSlice 重复定义， 已经定义在 %s:%d 处", routerSlice.pRouterMap.position.Filename, routerSlice.pRouterMap.position.Line)
+						} else {
+							d.pNode.pRouterMap = next.pSlice
+							routerSlice = d.pNode
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeRequestMap:
+						if resolveMapNote(d.pNode, next, &requestMap, "#RequestMap") {
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeResponseMap:
+						if resolveMapNote(d.pNode, next, &responseMap, "#ResponseMap") {
+							pendingList = append(pendingList, d.pNode)
+						}
+					case nodeTypeDesc:
+						if next.pFunc != nil {
+							next.pFunc.desc = d.pNode.text
+						} else if next.pStruct != nil {
+							next.pStruct.desc = d.pNode.text
+						}
+					case nodeTypePriority:
+						if next.pFunc != nil {
+							next.pFunc.priority = d.pNode.priority
+						} else if next.pStruct != nil {
+							next.pStruct.priority = d.pNode.priority
+						}
+					case nodeTypeRouterFallback:
+						if next.pMap != nil {
+							d.pNode.pRouterMap = next.pMap
+							fallbacks = append(fallbacks, d.pNode)
+						} else {
+							warnMapNotFound(d.pNode, next, "#RouterFallback")
+						}
+					case nodeTypeRouterEach:
+						if each := resolveRouterEach(d.pNode, next); len(each) > 0 {
+							pendingList = append(pendingList, each...)
+							bRouted = true
+						}
+					case nodeTypeRouter:
+						if next.pFunc != nil { //找到路由目标函数或方法
+							d.pNode.pFunc = next.pFunc
+							pendingList = append(pendingList, d.pNode)
+							bRouted = true
+						} else {
+							report(severityWarning, d.pNode.position, "#Router 没有找到有效的函数定义%s", foundDecl(next))
+						}
+					case nodeTypeRoute:
+						if next.pFunc != nil || next.pStruct != nil {
+							d.pNode.pFunc = next.pFunc
+							d.pNode.pStruct = next.pStruct
+							compacts = append(compacts, d.pNode)
+						} else {
+							report(severityWarning, d.pNode.position, "#Route 没有找到有效的函数或结构定义%s", foundDecl(next))
+						}
+					case nodeTypeMapping:
+						if next.pStruct != nil { //找到结构映射目标结构
+							d.pNode.pStruct = next.pStruct
+							pendingList = append(pendingList, d.pNode)
+							bMapped = true
+						} else {
+							report(severityWarning, d.pNode.position, "#Mapping 没有找到有效的结构定义%s", foundDecl(next))
+						}
+					}
+				}
+			}
+		}
+	}
+	checkGenerateDirectives()
+	//展开多Map映射
+	for _, node := range compacts {
+		for _, n := range expandRoute(node, routerMapNodes, mappingMap) {
+			pendingList = append(pendingList, n)
+			if n.noteType == nodeTypeRouter {
+				bRouted = true
+			} else {
+				bMapped = true
+			}
+		}
+	}
+	checkAmbiguousTargets(pendingList)
+
+	//没有需要执行的操作
+	if len(pendingList) == 0 && len(fallbacks) == 0 && len(pairs) == 0 {
+		return nil, false
+	}
+
+	routes := make([]*routeInfo, 0)
+	mappings := make([]*routeInfo, 0)
+	//已映射的常量，Map名称.常量名 -> 映射关系，用于检查重复映射
+	routedKeys := make(map[string]*routeInfo)
+	//已检查过key类型的Map，key类型未定义的Map只报告一次
+	checkedKeyTypes := make(map[*mapType]bool)
+	//校验映射关系
+	if bRouted {
+		if routerMap == nil {
+			report(severityWarning, token.Position{}, "#RouterMap 未定义，Router映射无法处理")
+		}else{
+			selectRouterMaps(pendingList, routerMapNodes)
+			for _, node := range pendingList {
+				if node.noteType == nodeTypeRouter {
+					routerMap := node.pRouterMap
+					//公共注册表要求映射的函数都是导出的
+					if options.RequireExported && !ast.IsExported(node.pFunc.funcName) {
+						if options.FailFast {
+							report(severityError, node.pFunc.position, "映射的函数 %s 未导出，处理程序中断", node.pFunc.funcName)
+							return nil, false
+						}
+						report(severityError, node.pFunc.position, "映射的函数 %s 未导出，忽略此映射", node.pFunc.funcName)
+						continue
+					}
+					if !routerMap.external && !checkKeyType(routerMap, checkedKeyTypes) {
+						continue
+					}
+					checkKeyCount(node, routerMap.keyType)
+					for _, c := range node.keys {
+						//常量检查，设置函数的key类型由编译器检查
+						if routerMap.external && !isExternalKey(c) || !routerMap.external && !checkKey(routerMap.keyType, c) {
+							report(severityWarning, node.position, "指定的常量 %s 未定义或者与映射Map的key类型 %s 不一致", c, routerMap.keyType)
+							continue
+						}
+						if !validateKey(node, routerMap.keyType, c) {
+							continue
+						}
+						//函数类型检查，签名不一致时尝试生成适配函数
+						fn := funcTarget(node.pFunc, routerMap.valueType)
+						target := fn.funcName
+						//泛型函数无法按Map的值类型推导类型参数时不能保存
+						bGeneric := len(fn.typeParams) > 0
+						if bGeneric || !routerMap.external && !checkFuncType(routerMap.valueType, fn.typeString) {
+							adapter, bAdapted := "", false
+							if options.Adapters && !bGeneric {
+								adapter, bAdapted = renderAdapter(routerMap.valueType, fn)
+							}
+							//给出可以直接复制到Map定义中的值类型
+							if !bAdapted && !bGeneric {
+								report(severityNote, node.pFunc.position, "将 Map %s 的值类型改为: %s", routerMap.name, fn.typeString)
+							}
+							//由生成的编译期检查在函数的位置报告错误
+							if !bAdapted && options.TypeAssertions {
+								report(severityWarning, node.pFunc.position, "定义的函数类型 【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，编译时将在此处报告错误", fn.typeString, routerMap.position.Filename, routerMap.position.Line, routerMap.name, routerMap.valueType)
+								adapter, bAdapted = target, true
+							}
+							if !bAdapted {
+								if options.FailFast {
+									report(severityError, node.pFunc.position, "定义的函数类型 【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，处理程序中断", fn.typeString, routerMap.position.Filename,routerMap.position.Line, routerMap.name, routerMap.valueType)
+									return nil, false
+								}
+								report(severityError, node.pFunc.position, "定义的函数类型 【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，忽略此映射", fn.typeString, routerMap.position.Filename,routerMap.position.Line, routerMap.name, routerMap.valueType)
+								continue
+							}
+							target = adapter
+						}
+						route := &routeInfo{
+							key:      c,
+							target:   target,
+							pMap:     routerMap,
+							pNode:    node,
+							position: node.pFunc.position,
+							desc:     node.pFunc.desc,
+							priority: node.pFunc.priority,
+						}
+						if checkDuplicate(routedKeys, route) {
+							routes = append(routes, route)
+						}
+					}
+				}
+			}
+		}
+	}
+	if bMapped {
+		if mappingMap == nil {
+			report(severityWarning, token.Position{}, "#MappingMap 未定义，Mapping映射无法处理")
+		}else {
+			for _, node := range pendingList {
+				if node.noteType == nodeTypeMapping {
+					if !checkKeyType(mappingMap, checkedKeyTypes) {
+						continue
+					}
+					checkKeyCount(node, mappingMap.keyType)
+					for _, c := range node.keys {
+						//常量检查
+						if checkKey(mappingMap.keyType, c) == false {
+							report(severityWarning, node.position, "指定的常量 %s 未定义或者与映射Map的key类型 %s 不一致", c, mappingMap.keyType)
+							continue
+						}
+						if !validateKey(node, mappingMap.keyType, c) {
+							continue
+						}
+						//结构类型检查，标准库中的接口类型无法分析其方法集，交由编译器检查
+						if !acceptsStruct(mappingMap) {
+							if options.FailFast {
+								report(severityError, node.pStruct.position, "定义的结构【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，处理程序中断", node.pStruct.name, mappingMap.position.Filename, mappingMap.position.Line, mappingMap.name, mappingMap.valueType)
+								return nil, false
+							}
+							report(severityError, node.pStruct.position, "定义的结构【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，忽略此映射", node.pStruct.name, mappingMap.position.Filename, mappingMap.position.Line, mappingMap.name, mappingMap.valueType)
+							continue
+						}
+						route := &routeInfo{
+							key:      c,
+							target:   node.pStruct.name,
+							pMap:     mappingMap,
+							pNode:    node,
+							position: node.pStruct.position,
+							desc:     node.pStruct.desc,
+							pointer:  node.pointer,
+							priority: node.pStruct.priority,
+						}
+						if checkDuplicate(routedKeys, route) {
+							mappings = append(mappings, route)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	//请求、响应结构映射
+	requests := make([]*routeInfo, 0)
+	responses := make([]*routeInfo, 0)
+	if len(pairs) > 0 {
+		if requestMap == nil || responseMap == nil {
+			report(severityWarning, token.Position{}, "#RequestMap 或 #ResponseMap 未定义，MappingPair映射无法处理")
+		} else {
+			for _, node := range pairs {
+				if !checkKeyType(requestMap, checkedKeyTypes) || !checkKeyType(responseMap, checkedKeyTypes) {
+					continue
+				}
+				request, response, ok := resolveMappingPair(node, requestMap, responseMap)
+				if !ok {
+					return nil, false
+				}
+				if request != nil {
+					requests = append(requests, request)
+					responses = append(responses, response)
+				}
+			}
+		}
+	}
+
+	//按常量值的顺序生成映射
+	sortRoutes(routes)
+	sortRoutes(mappings)
+	sortRoutes(requests)
+	sortRoutes(responses)
+
+	//常量名称映射
+	names := make([]*routeInfo, 0)
+	if nameMap != nil {
+		if nameMap.valueType != "string" {
+			report(severityWarning, nameMap.position, "#NameMap 的值类型必须是 string，名称映射无法处理")
+		} else {
+			named := make(map[string]bool)
+			for _, route := range routes {
+				//复合字面量与字面量常量没有名称
+				if named[route.key] || isCompositeKey(route.key) || isLiteralKey(route.key) {
+					continue
+				}
+				if !checkConst(nameMap.keyType, route.key) {
+					report(severityWarning, route.pNode.position, "常量 %s 与名称映射Map的key类型 %s 不一致", route.key, nameMap.keyType)
+					continue
+				}
+				named[route.key] = true
+				names = append(names, &routeInfo{
+					key:    route.key,
+					target: strconv.Quote(transformName(route.key)),
+					pMap:   nameMap,
+					pNode:  route.pNode,
+				})
+			}
+		}
+	}
+
+	//默认#RouterMap中的映射，用于生成命令名称映射与切片映射
+	defaultRoutes := make([]*routeInfo, 0, len(routes))
+	for _, route := range routes {
+		if route.pMap == routerMap {
+			defaultRoutes = append(defaultRoutes, route)
+		}
+	}
+
+	//命令名称映射，去除前缀并转换为小写的常量名 -> 函数
+	cmdNames := make([]*routeInfo, 0)
+	if cmdNameMap != nil && routerMap != nil {
+		if cmdNameMap.keyType != "string" {
+			report(severityWarning, cmdNameMap.position, "#CmdNameMap 的key类型必须是 string，命令名称映射无法处理")
+		} else if cmdNameMap.valueType != routerMap.valueType && cmdNameMap.valueType != "interface{}" {
+			report(severityWarning, cmdNameMap.position, "#CmdNameMap 的值类型 %s 与 #RouterMap 的值类型 %s 不一致，命令名称映射无法处理", cmdNameMap.valueType, routerMap.valueType)
+		} else {
+			//未指定前缀时去除key类型名称，如 CmdLogin -> login
+			prefix := routerMap.keyType
+			if len(cmdNameNode.keys) > 0 {
+				prefix = cmdNameNode.keys[0]
+			}
+			named := make(map[string]*routeInfo)
+			for _, route := range defaultRoutes {
+				if isCompositeKey(route.key) || isLiteralKey(route.key) {
+					continue
+				}
+				name := strings.ToLower(strings.TrimPrefix(route.key, prefix))
+				if name == "" {
+					name = strings.ToLower(route.key)
+				}
+				if exist, ok := named[name]; ok {
+					if exist.key != route.key {
+						report(severityWarning, route.pNode.position, "常量 %s 与 %s 的命令名称都是 %s，只保留 %s 的映射", route.key, exist.key, name, exist.key)
+					}
+					continue
+				}
+				named[name] = route
+				cmdNames = append(cmdNames, &routeInfo{
+					key:      strconv.Quote(name),
+					target:   route.target,
+					pMap:     cmdNameMap,
+					pNode:    route.pNode,
+					position: route.position,
+				})
+			}
+		}
+	}
+
+	//结构反向映射，结构名 -> 常量
+	reverses := make([]*routeInfo, 0)
+	if mappingReverseMap != nil {
+		if mappingReverseMap.keyType != "string" {
+			report(severityWarning, mappingReverseMap.position, "#MappingReverse 的key类型必须是 string，结构反向映射无法处理")
+		} else {
+			reversed := make(map[string]bool)
+			for _, route := range mappings {
+				//同一结构映射了多个常量时使用第一个常量
+				if reversed[route.target] {
+					continue
+				}
+				if !checkConst(mappingReverseMap.valueType, route.key) {
+					report(severityWarning, route.pNode.position, "常量 %s 与结构反向映射Map的值类型 %s 不一致", route.key, mappingReverseMap.valueType)
+					continue
+				}
+				reversed[route.target] = true
+				reverses = append(reverses, &routeInfo{
+					key:    strconv.Quote(route.target),
+					target: route.key,
+					pMap:   mappingReverseMap,
+					pNode:  route.pNode,
+				})
+			}
+		}
+	}
+
+	//方法反向映射，函数名 -> 常量
+	routerReverses := make([]*routeInfo, 0)
+	if routerReverseMap != nil {
+		if routerReverseMap.keyType != "string" {
+			report(severityWarning, routerReverseMap.position, "#RouterReverse 的key类型必须是 string，方法反向映射无法处理")
+		} else {
+			reversed := make(map[string]bool)
+			for _, route := range routes {
+				//同一函数映射了多个常量时使用第一个常量
+				name := handlerName(route.pNode.pFunc)
+				if reversed[name] {
+					continue
+				}
+				if !checkKey(routerReverseMap.valueType, route.key) {
+					report(severityWarning, route.pNode.position, "常量 %s 与方法反向映射Map的值类型 %s 不一致", route.key, routerReverseMap.valueType)
+					continue
+				}
+				reversed[name] = true
+				routerReverses = append(routerReverses, &routeInfo{
+					key:    strconv.Quote(name),
+					target: route.key,
+					pMap:   routerReverseMap,
+					pNode:  route.pNode,
+				})
+			}
+		}
+	}
+
+	//按常量值下标分派的切片
+	slices := make([]*routeInfo, 0)
+	var sliceGuard *codeDecl
+	if routerSlice != nil {
+		if slice, guard := resolveRouterSlice(routerSlice, defaultRoutes); slice != nil {
+			slices = append(slices, slice)
+			sliceGuard = guard
+		}
+	}
+
+	//结构字段标签映射，常量 -> 字段名 -> 标签
+	tags := make([]*routeInfo, 0)
+	if tagMap != nil {
+		if tagMap.valueType != "map[string]string" {
+			report(severityWarning, tagMap.position, "#TagMap 的值类型必须是 map[string]string，结构标签映射无法处理")
+		} else {
+			tagged := make(map[string]bool)
+			for _, route := range mappings {
+				if tagged[route.key] {
+					continue
+				}
+				if !checkKey(tagMap.keyType, route.key) {
+					report(severityWarning, route.pNode.position, "常量 %s 与结构标签映射Map的key类型 %s 不一致", route.key, tagMap.keyType)
+					continue
+				}
+				tagged[route.key] = true
+				tags = append(tags, &routeInfo{
+					key:    route.key,
+					target: renderTags(route.pNode.pStruct.tags),
+					pMap:   tagMap,
+					pNode:  route.pNode,
+				})
+			}
+		}
+	}
+
+	//方法映射与结构映射的Map是有序Map时调用Add方法添加映射
+	//指定泛型注册函数时所有Map的映射关系都通过注册函数保存
+	//泛型注册函数需要目标版本支持泛型
+	bRegister := options.RegisterFunc != ""
+	if bRegister && !goVersionAtLeast(18) {
+		report(severityWarning, token.Position{}, "选项RegisterFunc生成的泛型注册函数需要Go 1.18以上，目标版本GoVersion为 %s，使用赋值语句保存映射", options.GoVersion)
+		bRegister = false
+	}
+	assign, assignStruct := renderAssign, renderStruct
+	if bRegister {
+		assign, assignStruct = renderRegisterAssign, renderRegisterStruct
+	}
+	renderRoute, renderMapping := assign, assignStruct
+	if options.AddMethod != "" {
+		renderRoute, renderMapping = renderAddAssign, renderAddStruct
+	}
+	sections := []*codeSection{
+		{name: "方法映射", routes: routes, render: renderSetter(renderRoute)},
+		{name: "结构映射", routes: mappings, render: renderMapping, mapping: true},
+		{name: "名称映射", routes: names, render: assign},
+		{name: "命令名称映射", routes: cmdNames, render: assign},
+		{name: "结构反向映射", routes: reverses, render: assign, mapping: true},
+		{name: "方法反向映射", routes: routerReverses, render: assign},
+		{name: "切片映射", routes: slices, render: renderSlice},
+		{name: "结构标签映射", routes: tags, render: assign, mapping: true},
+		{name: "请求结构映射", routes: requests, render: assignStruct, mapping: true},
+		{name: "响应结构映射", routes: responses, render: assignStruct, mapping: true},
+	}
+	checkExported(sections)
+	checkShadowed(sections, filepath.Join(roots[0], options.OutputDir))
+	checkInitRefs(sections)
+	checkMapInits(sections)
+	//Map查找函数
+	decls := make([]*codeDecl, 0)
+	//泛型注册函数，同一个包中只能定义一次，生成到第一个非测试文件的映射所在的输出文件中
+	if bRegister {
+		var first *routeInfo
+		for _, section := range sections {
+			for _, route := range section.routes {
+				if first == nil || strings.HasSuffix(first.position.Filename, "_test.go") && !strings.HasSuffix(route.position.Filename, "_test.go") {
+					first = route
+				}
+			}
+		}
+		if first != nil {
+			decls = append(decls, &codeDecl{
+				position: first.position,
+				code:     renderRegisterFunc(),
+			})
+		}
+	}
+	fallbackMaps := make(map[string]*nodeInfo)
+	for _, node := range fallbacks {
+		if exist, ok := fallbackMaps[node.pRouterMap.name]; ok {
+			report(severityWarning, node.position, "#RouterFallback 重复定义， %s 的默认值已经定义在 %s:%d 处", node.pRouterMap.name, exist.position.Filename, exist.position.Line)
+			continue
+		}
+		if _, err := parser.ParseExpr(node.text); err != nil {
+			report(severityWarning, node.position, "#RouterFallback 默认值表达式 %s 无法解析：%s", node.text, err.Error())
+			continue
+		}
+		fallbackMaps[node.pRouterMap.name] = node
+		decls = append(decls, &codeDecl{
+			position: node.position,
+			code:     renderFallback(node.pRouterMap, node.text),
+		})
+	}
+
+	//switch分派模式，每个#RouterMap生成一个分派函数，方法映射不再保存到Map中
+	if options.Mode == SwitchDispatch && len(routes) > 0 {
+		if options.ValidateRoutes {
+			report(severityWarning, token.Position{}, "SwitchDispatch 模式下方法映射不保存到Map中，ValidateRoutes 函数检查的Map中没有映射")
+		}
+		maps := make([]*mapType, 0)
+		dispatch := make(map[string][]*routeInfo)
+		//设置函数的映射仍然在init函数中调用
+		external := make([]*routeInfo, 0)
+		for _, route := range routes {
+			if route.pMap.external {
+				external = append(external, route)
+				continue
+			}
+			if _, ok := dispatch[route.pMap.name]; !ok {
+				maps = append(maps, route.pMap)
+			}
+			dispatch[route.pMap.name] = append(dispatch[route.pMap.name], route)
+		}
+		for _, pMap := range maps {
+			fallback := "nil"
+			if node, ok := fallbackMaps[pMap.name]; ok {
+				fallback = node.text
+			}
+			decls = append(decls, &codeDecl{
+				position: pMap.position,
+				code:     renderDispatcher(pMap, dispatch[pMap.name], fallback),
+			})
+		}
+		sections[0].routes = external
+	}
+
+	//运行时检查映射完整性的函数
+	if options.ValidateRoutes && routerMap != nil && !routerMap.external {
+		consts := make([]string, 0)
+		for _, t := range typeList {
+			if t.typeName == routerMap.keyType {
+				consts = t.constValues
+				break
+			}
+		}
+		if len(consts) == 0 {
+			report(severityWarning, routerMap.position, "没有找到 %s 类型的常量定义，无法生成 ValidateRoutes 函数", routerMap.keyType)
+		} else {
+			decls = append(decls, &codeDecl{
+				position: routerMap.position,
+				code:     renderValidator(routerMap, consts),
+				imports:  []string{strconv.Quote("errors")},
+			})
+		}
+	}
+
+	//映射覆盖率，key类型的常量总数与已映射的常量数量
+	if options.RouteCoverage && routerMap != nil {
+		total := constCount(routerMap.keyType)
+		if total <= 0 {
+			report(severityWarning, routerMap.position, "没有找到 %s 类型的常量定义，无法生成 RouteCoverage 变量", routerMap.keyType)
+		} else {
+			mapped := make(map[string]bool)
+			for _, route := range routes {
+				if route.pMap.name == routerMap.name && checkConst(routerMap.keyType, route.key) {
+					mapped[route.key] = true
+				}
+			}
+			decls = append(decls, &codeDecl{
+				position: routerMap.position,
+				code:     renderCoverage(routerMap, total, len(mapped)),
+			})
+		}
+	}
+
+	//映射函数类型的编译期检查，按输出文件分别生成
+	if options.TypeAssertions {
+		assertions := make(map[string][]*routeInfo)
+		names := make([]string, 0)
+		for _, route := range routes {
+			//设置函数没有值类型，由编译器检查调用
+			if route.pMap.external {
+				continue
+			}
+			name := outputFor(route.position, false)
+			if _, ok := assertions[name]; !ok {
+				names = append(names, name)
+			}
+			assertions[name] = append(assertions[name], route)
+		}
+		for _, name := range names {
+			decls = append(decls, &codeDecl{
+				position: assertions[name][0].position,
+				code:     renderAssertions(assertions[name], filepath.Join(roots[0], options.OutputDir)),
+			})
+		}
+	}
+	//切片下标的编译期检查
+	if sliceGuard != nil {
+		decls = append(decls, sliceGuard)
+	}
+
+	return &routeModel{
+		routes:   routes,
+		mappings: mappings,
+		sections: sections,
+		decls:    decls,
+	}, true
+}
+
+//获取结构中带标签的字段，同一字段声明中的多个字段使用相同的标签
+func getFieldTags(st *ast.StructType) []fieldTag {
+	tags := make([]fieldTag, 0)
+	if st.Fields == nil {
+		return tags
+	}
+	for _, field := range st.Fields.List {
+		if field.Tag == nil {
+			continue
+		}
+		tag, err := strconv.Unquote(field.Tag.Value)
+		if err != nil {
+			continue
+		}
+		names := make([]string, 0, len(field.Names))
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+		}
+		//匿名字段使用类型名作为字段名
+		if len(names) == 0 {
+			typeName := strings.TrimPrefix(getTypeString(field.Type), "*")
+			names = append(names, typeName[strings.LastIndex(typeName, ".")+1:])
+		}
+		for _, name := range names {
+			tags = append(tags, fieldTag{field: name, tag: tag})
+		}
+	}
+	return tags
+}
+
+//生成结构字段标签的map字面量
+func renderTags(tags []fieldTag) string {
+	items := make([]string, 0, len(tags))
+	for _, t := range tags {
+		items = append(items, strconv.Quote(t.field)+": "+strconv.Quote(t.tag))
+	}
+	return "map[string]string{" + strings.Join(items, ", ") + "}"
+}
+
+//文件是否是自动生成的映射文件
+func isGeneratedAST(f *ast.File, fSet *token.FileSet) bool {
+	for _, cg := range f.Comments {
+		if fSet.Position(cg.Pos()).Line > 3 {
+			break
+		}
+		if strings.Contains(cg.Text(), generatedMarker) {
+			return true
+		}
+	}
+	return false
+}
+
+//收集init函数中引用的标识符，同一标识符只记录第一次引用的位置
+func collectInitRefs(body *ast.BlockStmt, fSet *token.FileSet) []initRef {
+	refs := make([]initRef, 0)
+	seen := make(map[string]bool)
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.SelectorExpr: //其他包或结构中的同名标识符不是包级变量
+			ast.Inspect(x.X, func(n ast.Node) bool {
+				if ident, ok := n.(*ast.Ident); ok && !seen[ident.Name] {
+					seen[ident.Name] = true
+					refs = append(refs, initRef{name: ident.Name, position: fSet.Position(ident.Pos())})
+				}
+				return true
+			})
+			return false
+		case *ast.Ident:
+			if !seen[x.Name] {
+				seen[x.Name] = true
+				refs = append(refs, initRef{name: x.Name, position: fSet.Position(x.Pos())})
+			}
+		}
+		return true
+	})
+	return refs
+}
+
+//收集函数中对包级变量赋值新Map的位置，如 m = make(map[Cmd]func()) 或 m = map[Cmd]func(){}
+//函数中声明的同名局部变量不是包级变量
+func collectMapInits(body *ast.BlockStmt, fSet *token.FileSet) []mapInit {
+	inits := make([]mapInit, 0)
+	ast.Inspect(body, func(n ast.Node) bool {
+		assign, ok := n.(*ast.AssignStmt)
+		if !ok || assign.Tok != token.ASSIGN || len(assign.Lhs) != len(assign.Rhs) {
+			return true
+		}
+		for i, lhs := range assign.Lhs {
+			ident, ok := lhs.(*ast.Ident)
+			if !ok || !isMapValue(assign.Rhs[i]) {
+				continue
+			}
+			if ident.Obj != nil && ident.Obj.Pos() >= body.Pos() && ident.Obj.Pos() < body.End() {
+				continue
+			}
+			inits = append(inits, mapInit{name: ident.Name, position: fSet.Position(ident.Pos())})
+		}
+		return true
+	})
+	return inits
+}
+
+//表达式是否创建新的Map，make(map[K]V) 或 map[K]V{}
+func isMapValue(expr ast.Expr) bool {
+	switch x := expr.(type) {
+	case *ast.CallExpr:
+		if fn, ok := x.Fun.(*ast.Ident); ok && fn.Name == "make" && len(x.Args) > 0 {
+			_, ok := x.Args[0].(*ast.MapType)
+			return ok
+		}
+	case *ast.CompositeLit:
+		_, ok := x.Type.(*ast.MapType)
+		return ok
+	}
+	return false
+}
+
+//检查生成代码填充的Map是否在多处初始化，重新初始化会替换已经填充了映射关系的Map
+func checkMapInits(sections []*codeSection) {
+	maps := make(map[string]bool)
+	for _, section := range sections {
+		for _, route := range section.routes {
+			maps[route.pMap.name] = true
+		}
+	}
+	inits := make(map[string][]mapInit)
+	for _, mi := range mapInits {
+		if maps[mi.name] {
+			inits[mi.name] = append(inits[mi.name], mi)
+		}
+	}
+	for _, list := range inits {
+		if len(list) < 2 {
+			continue
+		}
+		sort.SliceStable(list, func(i, j int) bool {
+			if list[i].position.Filename != list[j].position.Filename {
+				return list[i].position.Filename < list[j].position.Filename
+			}
+			return list[i].position.Offset < list[j].position.Offset
+		})
+		for _, mi := range list[1:] {
+			report(severityWarning, mi.position, "Map %s 已经在 %s:%d 处初始化，再次初始化会替换生成代码填充的Map，映射关系可能丢失", mi.name, list[0].position.Filename, list[0].position.Line)
+		}
+	}
+}
+
+//检查用户定义的init函数是否引用了生成代码填充的Map
+//同一个包中init函数的执行顺序取决于文件名，用户的init函数可能在映射生成之前执行
+func checkInitRefs(sections []*codeSection) {
+	maps := make(map[string]bool)
+	for _, section := range sections {
+		for _, route := range section.routes {
+			maps[route.pMap.name] = true
+		}
+	}
+	for _, ref := range initRefs {
+		if maps[ref.name] {
+			report(severityWarning, ref.position, "init 函数引用了自动生成代码填充的Map %s，init函数的执行顺序取决于文件名，可能读取到不完整的映射，建议统一使用注解生成映射", ref.name)
+		}
+	}
+}
+
+//去除注解标记外的包裹符号，如选项AnnotationPrefix为[、AnnotationSuffix为]时 //[#Router Const1] 作为 //#Router Const1 处理
+//不是包裹的注解时原样返回
+func unwrapAnnotation(text string) string {
+	if options.AnnotationPrefix == "" && options.AnnotationSuffix == "" {
+		return text
+	}
+	inner := strings.TrimSpace(strings.TrimPrefix(text, "//"))
+	if !strings.HasPrefix(inner, options.AnnotationPrefix) || !strings.HasSuffix(inner, options.AnnotationSuffix) {
+		return text
+	}
+	inner = strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(inner, options.AnnotationPrefix), options.AnnotationSuffix))
+	if !strings.HasPrefix(inner, "#") {
+		return text
+	}
+	return "//" + inner
+}
+
+//注释是否是指定的注解，注解名之后不能紧接字母、数字或下划线，如 //#RouterMapFoo 不是 //#Router 注解
+//注解名之后可以直接是中文说明，如 //#Desc登录
+func hasDirective(text, name string) bool {
+	if len(text) < len(name) || strings.ToUpper(text[:len(name)]) != strings.ToUpper(name) {
+		return false
+	}
+	if len(text) == len(name) {
+		return true
+	}
+	c := text[len(name)]
+	return !(c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z')
+}
+
+//规范化注解文本，去除首尾空白字符及 // 与 # 之间的空白字符，如 "// #RouterMap " 规范化为 "//#RouterMap"
+//不是注解的注释保持不变
+func normalizeAnnotation(text string) string {
+	if !strings.HasPrefix(text, "//") {
+		return text
+	}
+	inner := strings.TrimSpace(text[2:])
+	if !strings.HasPrefix(inner, "#") {
+		return text
+	}
+	return "//" + inner
+}
+
+//计算常量表达式的值，只支持iota、整数字面量、已声明的常量及其运算，如 Cmd(iota + 1)
+func evalConst(expr ast.Expr, iota int64) (int64, bool) {
+	switch x := expr.(type) {
+	case *ast.BasicLit:
+		if x.Kind == token.INT {
+			v, err := strconv.ParseInt(x.Value, 0, 64)
+			return v, err == nil
+		}
+	case *ast.Ident:
+		if x.Name == "iota" {
+			return iota, true
+		}
+		if c, ok := constList[x.Name]; ok {
+			return c.value, c.known
+		}
+	case *ast.ParenExpr:
+		return evalConst(x.X, iota)
+	case *ast.CallExpr: //类型转换，如 Cmd(1)
+		if _, ok := x.Fun.(*ast.Ident); ok && len(x.Args) == 1 {
+			return evalConst(x.Args[0], iota)
+		}
+	case *ast.UnaryExpr:
+		v, ok := evalConst(x.X, iota)
+		if !ok {
+			return 0, false
+		}
+		switch x.Op {
+		case token.ADD:
+			return v, true
+		case token.SUB:
+			return -v, true
+		case token.XOR:
+			return ^v, true
+		}
+	case *ast.BinaryExpr:
+		l, ok := evalConst(x.X, iota)
+		if !ok {
+			return 0, false
+		}
+		r, ok := evalConst(x.Y, iota)
+		if !ok {
+			return 0, false
+		}
+		switch x.Op {
+		case token.ADD:
+			return l + r, true
+		case token.SUB:
+			return l - r, true
+		case token.MUL:
+			return l * r, true
+		case token.QUO:
+			if r != 0 {
+				return l / r, true
+			}
+		case token.REM:
+			if r != 0 {
+				return l % r, true
+			}
+		case token.SHL:
+			if r >= 0 {
+				return l << uint64(r), true
+			}
+		case token.SHR:
+			if r >= 0 {
+				return l >> uint64(r), true
+			}
+		case token.AND:
+			return l & r, true
+		case token.OR:
+			return l | r, true
+		case token.XOR:
+			return l ^ r, true
+		case token.AND_NOT:
+			return l &^ r, true
+		}
+	}
+	return 0, false
+}
+
+//按选项排序映射关系，按映射目标或源码位置排序时相同的部分按key的顺序排列
+func sortRoutes(routes []*routeInfo) {
+	sortRoutesByKey(routes)
+	switch options.SortOrder {
+	case SortByKey:
+		//多个Map的映射按Map的定义顺序分组
+		sort.SliceStable(routes, func(i, j int) bool {
+			pi, pj := routes[i].pMap.position, routes[j].pMap.position
+			if pi.Filename != pj.Filename {
+				return pi.Filename < pj.Filename
+			}
+			return pi.Offset < pj.Offset
+		})
+	case SortByTarget:
+		sort.SliceStable(routes, func(i, j int) bool {
+			return routes[i].target < routes[j].target
+		})
+	case SortByPosition:
+		sort.SliceStable(routes, func(i, j int) bool {
+			pi, pj := routePosition(routes[i]), routePosition(routes[j])
+			if pi.Filename != pj.Filename {
+				return pi.Filename < pj.Filename
+			}
+			if pi.Line != pj.Line {
+				return pi.Line < pj.Line
+			}
+			return pi.Column < pj.Column
+		})
+	case SortByPriority:
+		sort.SliceStable(routes, func(i, j int) bool {
+			return routes[i].priority < routes[j].priority
+		})
+	}
+}
+
+//映射关系在源码中的位置，没有映射目标位置时使用映射注释的位置
+func routePosition(route *routeInfo) token.Position {
+	if route.position.Filename != "" {
+		return route.position
+	}
+	return route.pNode.position
+}
+
+//按常量值排序映射关系，常量值无法全部计算时按常量声明顺序排序
+//包含未声明常量的key时（如复合字面量）保持原有顺序
+func sortRoutesByKey(routes []*routeInfo) {
+	known := true
+	for _, route := range routes {
+		c, ok := constList[route.key]
+		if !ok {
+			return
+		}
+		known = known && c.known
+	}
+	sort.SliceStable(routes, func(i, j int) bool {
+		ci, cj := constList[routes[i].key], constList[routes[j].key]
+		if known && ci.value != cj.value {
+			return ci.value < cj.value
+		}
+		return ci.index < cj.index
+	})
+}
+
+//生成运行时检查映射完整性的函数，检查Map中是否包含key类型的全部常量
+func renderValidator(pMap *mapType, consts []string) string {
+	lines := []string{
+		fmt.Sprintf("//ValidateRoutes 检查 %s 中是否包含 %s 类型全部常量的映射，返回缺少映射的常量", pMap.name, pMap.keyType),
+		"func ValidateRoutes() error {",
+		"\tkeys := []struct {",
+		"\t\tname string",
+		"\t\tkey  " + qualify(pMap.keyType),
+		"\t}{",
+	}
+	for _, c := range consts {
+		lines = append(lines, fmt.Sprintf("\t\t{%s, %s},", strconv.Quote(c), qualify(c)))
+	}
+	lines = append(lines,
+		"\t}",
+		"\tmissing := \"\"",
+		"\tfor _, k := range keys {",
+		fmt.Sprintf("\t\tif value, ok := %s[k.key]; !ok || value == nil {", qualify(pMap.name)),
+		"\t\t\tif missing != \"\" {",
+		"\t\t\t\tmissing += \", \"",
+		"\t\t\t}",
+		"\t\t\tmissing += k.name",
+		"\t\t}",
+		"\t}",
+		"\tif missing != \"\" {",
+		fmt.Sprintf("\t\treturn errors.New(%s + missing)", strconv.Quote(pMap.name+" 缺少常量的映射: ")),
+		"\t}",
+		"\treturn nil",
+		"}",
+	)
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+//生成记录映射覆盖率的变量，用于运行时输出已映射的常量数量
+func renderCoverage(pMap *mapType, total, mapped int) string {
+	return fmt.Sprintf("//RouteCoverage 记录 %s 的key类型 %s 的常量总数与已映射的常量数量\r\nvar RouteCoverage = struct{ Total, Mapped int }{%d, %d}\r\n", pMap.name, pMap.keyType, total, mapped)
+}
+
+//使用#Router映射关系生成按常量值下标分派的切片，常量值必须是可以计算的非负整数
+//生成带下标的切片字面量，如 handlers = []func(){CmdA: fa, CmdB: fb}，切片长度为最大常量值加一
+//同时返回下标的编译期检查，常量值变化后没有重新生成时编译失败
+func resolveRouterSlice(node *nodeInfo, routes []*routeInfo) (*routeInfo, *codeDecl) {
+	pSlice := node.pRouterMap
+	items := make([]string, 0, len(routes))
+	values := make(map[int64]string)
+	var max int64 = -1
+	for _, route := range routes {
+		c, ok := constList[route.key]
+		if !ok || !c.known || c.value < 0 {
+			report(severityWarning, route.pNode.position, "#RouterSlice 常量 %s 的值不是可以计算的非负整数，无法生成切片映射", route.key)
+			continue
+		}
+		if exist, ok := values[c.value]; ok {
+			if exist != route.key {
+				report(severityWarning, route.pNode.position, "#RouterSlice 常量 %s 与 %s 的值都是 %d，只保留 %s 的映射", route.key, exist, c.value, exist)
+			}
+			continue
+		}
+		if !checkFuncType(pSlice.valueType, route.pNode.pFunc.typeString) {
+			report(severityWarning, route.pNode.position, "定义的函数类型 【%s】 与切片 %s 的元素类型【%s】不一致，忽略此映射", route.pNode.pFunc.typeString, pSlice.name, pSlice.valueType)
+			continue
+		}
+		values[c.value] = route.key
+		items = append(items, route.key+": "+route.target)
+		if c.value > max {
+			max = c.value
+		}
+	}
+	if len(items) == 0 {
+		return nil, nil
+	}
+	//切片长度按key类型的全部常量确定，末尾没有映射的常量分派时得到nil而不是下标越界
+	//下标检查包含key类型的全部常量，没有映射的常量值变化时同样需要重新生成
+	mapped := max
+	last := ""
+	guarded := make(map[int64]string)
+	for k, v := range values {
+		guarded[k] = v
+	}
+	for _, t := range typeList {
+		if t.typeName != routes[0].pMap.keyType {
+			continue
+		}
+		for _, name := range t.constValues {
+			c, ok := constList[name]
+			if !ok || !c.known || c.value < 0 {
+				continue
+			}
+			if _, ok := guarded[c.value]; !ok {
+				guarded[c.value] = name
+			}
+			if c.value > max {
+				max, last = c.value, name
+			}
+		}
+	}
+	if max > mapped {
+		items = append(items, last+": nil")
+	}
+	//切片中没有映射的下标分派时得到nil
+	gaps := make([]string, 0)
+	for i := int64(0); i <= max; i++ {
+		if _, ok := values[i]; !ok {
+			gaps = append(gaps, strconv.FormatInt(i, 10))
+		}
+	}
+	if len(gaps) > 0 {
+		report(severityWarning, pSlice.position, "#RouterSlice %s 的下标 %s 没有映射，分派时需要检查 nil", pSlice.name, strings.Join(gaps, ", "))
+	}
+	slice := &routeInfo{
+		target: "[]" + pSlice.valueType + "{" + strings.Join(items, ", ") + "}",
+		pMap:   pSlice,
+		pNode:  node,
+	}
+	guard := &codeDecl{
+		position: node.position,
+		code:     renderSliceGuard(pSlice, guarded, max),
+	}
+	return slice, guard
+}
+
+//生成切片下标与长度的编译期检查，常量值与生成时不同时下标越界导致编译失败，如
+//func _() {
+//	var x [1]struct{}
+//	_ = x[CmdA-0]
+//}
+//const _ = uint(len([3]struct{}{}) - (int(CmdC) + 1))
+//长度检查使用key类型值最大的常量，如末尾的 CmdLast、CmdCount，在其之前增加常量后超出切片长度时编译失败
+func renderSliceGuard(pSlice *mapType, values map[int64]string, max int64) string {
+	lines := []string{
+		fmt.Sprintf("//%s 的下标检查，常量值发生变化后需要重新生成映射，否则此处编译失败", pSlice.name),
+		"func _() {",
+		"\tvar x [1]struct{}",
+	}
+	for i := int64(0); i <= max; i++ {
+		if key, ok := values[i]; ok {
+			lines = append(lines, fmt.Sprintf("\t_ = x[%s-%d]", qualify(key), i))
+		}
+	}
+	lines = append(lines, "}",
+		fmt.Sprintf("//%s 的长度检查，key类型的常量超出切片长度 %d 后需要重新生成映射，否则此处编译失败", pSlice.name, max+1),
+		fmt.Sprintf("const _ = uint(len([%d]struct{}{}) - (int(%s) + 1))", max+1, qualify(values[max])),
+	)
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+//生成带默认值的Map查找函数
+func renderFallback(pMap *mapType, fallback string) string {
+	lines := []string{
+		fmt.Sprintf("//%sLookup 获取 %s 中 key 对应的值，key 不存在时返回默认值", pMap.name, pMap.name),
+		fmt.Sprintf("func %sLookup(key %s) %s {", pMap.name, qualify(pMap.keyType), qualify(pMap.valueType)),
+		fmt.Sprintf("\tif value, ok := %s[key]; ok {", qualify(pMap.name)),
+		"\t\treturn value",
+		"\t}",
+		"\treturn " + qualify(fallback),
+		"}",
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+//生成使用switch按常量分派的函数，如 func mDispatch(key Cmd) func()，key没有映射时返回默认值
+func renderDispatcher(pMap *mapType, routes []*routeInfo, fallback string) string {
+	lines := []string{
+		fmt.Sprintf("//%sDispatch 获取 key 对应的映射，key 没有映射时返回 %s", pMap.name, fallback),
+		fmt.Sprintf("func %sDispatch(key %s) %s {", pMap.name, qualify(pMap.keyType), qualify(pMap.valueType)),
+		"\tswitch key {",
+	}
+	for _, route := range routes {
+		lines = append(lines, fmt.Sprintf("\tcase %s:", qualify(route.key)), "\t\treturn "+qualify(route.target))
+	}
+	lines = append(lines,
+		"\t}",
+		"\treturn "+qualify(fallback),
+		"}",
+	)
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+//生成映射函数类型的编译期检查，如 var _ func() = fa，同一函数只检查一次
+//使用 /*line*/ 指令将检查的位置指向映射函数的定义，类型不一致时编译器在映射函数处报告错误
+func renderAssertions(routes []*routeInfo, dir string) string {
+	lines := []string{"//映射函数类型的编译期检查"}
+	checked := make(map[string]bool)
+	for _, route := range routes {
+		fn := route.pNode.pFunc
+		//适配函数与批量映射的目标不是映射注释所在的函数
+		if fn == nil || route.target != fn.funcName || checked[route.pMap.name+"."+fn.funcName] {
+			continue
+		}
+		checked[route.pMap.name+"."+fn.funcName] = true
+		file := fn.position.Filename
+		if rel, err := filepath.Rel(dir, file); err == nil {
+			file = filepath.ToSlash(rel)
+		}
+		lines = append(lines, fmt.Sprintf("var _ %s = /*line %s:%d:%d*/%s", qualify(route.pMap.valueType), file, fn.position.Line, fn.position.Column, qualify(fn.funcName)))
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+//按#RouterEach的模板为常量声明中的每个常量生成映射注释，如 //#RouterEach handle%s Cmd 将 CmdLogin 映射到 handleLogin
+//模板后可以指定常量名中需要去除的前缀，未指定时使用常量的类型名
+func resolveRouterEach(node *nodeInfo, next *declPos) []*nodeInfo {
+	if len(next.consts) == 0 {
+		report(severityWarning, node.position, "#RouterEach 没有找到有效的常量定义")
+		return nil
+	}
+	//模板中只能包含一个 %s，其他 % 开始的格式无法生成有效的函数名
+	if len(node.keys) == 0 || strings.Count(node.keys[0], "%s") != 1 || strings.Count(node.keys[0], "%") != 1 {
+		report(severityWarning, node.position, "#RouterEach 需要指定只包含一个 %%s 的函数名模板，如 //#RouterEach handle%%s")
+		return nil
+	}
+	prefix := next.constType
+	if len(node.keys) > 1 {
+		prefix = node.keys[1]
+	}
+	nodes := make([]*nodeInfo, 0, len(next.consts))
+	for _, c := range next.consts {
+		name := strings.Replace(node.keys[0], "%s", strings.TrimPrefix(c, prefix), 1)
+		fn, ok := funcList[name]
+		if !ok {
+			report(severityWarning, node.position, "#RouterEach 常量 %s 对应的函数 %s 未定义", c, name)
+			continue
+		}
+		nodes = append(nodes, &nodeInfo{
+			file:     node.file,
+			position: node.position,
+			pos:      node.pos,
+			keys:     []string{c},
+			pFunc:    &fn,
+			noteType: nodeTypeRouter,
+		})
+	}
+	return nodes
+}
+
+//解析调用noteRouter的go:generate指令，返回noteRouter命令之后的参数
+func parseGenerateDirective(text string) ([]string, bool) {
+	if !strings.HasPrefix(text, "//go:generate ") {
+		return nil, false
+	}
+	fields := strings.Fields(text[len("//go:generate "):])
+	for i, field := range fields {
+		name := strings.TrimSuffix(field[strings.LastIndex(field, "/")+1:], ".exe")
+		if strings.EqualFold(name, "noteRouter") {
+			return fields[i+1:], true
+		}
+	}
+	return nil, false
+}
+
+//检查go:generate指令的参数与实际使用的选项是否一致，避免指令与实际生成方式不同步
+func checkGenerateDirectives() {
+	for _, directive := range generateDirectives {
+		for i := 0; i < len(directive.args); i++ {
+			name, value, hasValue := strings.Cut(strings.TrimLeft(directive.args[i], "-"), "=")
+			if name != "out" {
+				continue
+			}
+			if !hasValue && i+1 < len(directive.args) {
+				i++
+				value = directive.args[i]
+			}
+			if value != options.Output {
+				report(severityWarning, directive.position, "go:generate 指令指定的输出文件 %s 与实际使用的输出文件 %s 不一致", value, options.Output)
+			}
+		}
+	}
+}
+
+//获取包含注解的interface或struct类型定义，注解不在类型定义内部时返回nil
+func enclosingBody(dList linesSort, i int) *typeBody {
+	pos := dList[i].pos
+	for j := i - 1; j >= 0; j-- {
+		if dList[j].pNode != nil {
+			continue
+		}
+		for k := range dList[j].bodies {
+			body := &dList[j].bodies[k]
+			if body.pos < pos && pos < body.end {
+				return body
+			}
+		}
+		return nil
+	}
+	return nil
+}
+
+//展开#Route注解，name:key 中的name可以是 router、mapping 或者Map的变量名，多个映射之间可以使用空白或分号分隔
+//映射到#RouterMap的常量生成#Router映射，映射到#MappingMap的常量生成#Mapping映射
+func expandRoute(node *nodeInfo, routerMapNodes []*nodeInfo, mappingMap *mapType) []*nodeInfo {
+	//每个#RouterMap对应一个映射注释，router 对应默认的#RouterMap
+	routers := make([]*nodeInfo, 0, len(routerMapNodes))
+	for _, n := range routerMapNodes {
+		routers = append(routers, &nodeInfo{file: node.file, position: node.position, pos: node.pos, noteType: nodeTypeRouter, pFunc: node.pFunc, pRouterMap: n.pRouterMap, keys: make([]string, 0)})
+	}
+	mapping := &nodeInfo{file: node.file, position: node.position, pos: node.pos, noteType: nodeTypeMapping, pStruct: node.pStruct, keys: make([]string, 0)}
+	tokens := make([]string, 0, len(node.keys))
+	for _, key := range node.keys {
+		for _, token := range strings.Split(key, ";") {
+			if token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	for _, token := range tokens {
+		name, key, ok := strings.Cut(token, ":")
+		if !ok || name == "" || key == "" {
+			report(severityWarning, node.position, "#Route 格式错误 %s，应为 Map名称:常量名，如 router:Const1", token)
+			continue
+		}
+		router := -1
+		for i, n := range routers {
+			if name == n.pRouterMap.name || name == "router" && i == 0 {
+				router = i
+			}
+		}
+		switch {
+		case router >= 0:
+			if node.pFunc == nil {
+				report(severityWarning, node.position, "#Route %s 映射到 #RouterMap，需要注释函数定义", token)
+				continue
+			}
+			routers[router].keys = append(routers[router].keys, key)
+		case name == "mapping" || mappingMap != nil && name == mappingMap.name:
+			if node.pStruct == nil {
+				report(severityWarning, node.position, "#Route %s 映射到 #MappingMap，需要注释结构定义", token)
+				continue
+			}
+			mapping.keys = append(mapping.keys, key)
+		default:
+			report(severityWarning, node.position, "#Route 指定的Map %s 未定义", name)
+		}
+	}
+	nodes := make([]*nodeInfo, 0, len(routers)+1)
+	for _, n := range append(routers, mapping) {
+		if len(n.keys) > 0 {
+			nodes = append(nodes, n)
+		}
+	}
+	return nodes
+}
+
+//确定每个#Router映射到的#RouterMap，//#Router Map名称 常量1 常量2 映射到指定名称的Map
+//未指定名称时映射到key类型与常量一致的Map，多个Map的key类型都一致时映射到其中第一个定义的Map，都不一致时映射到第一个定义的Map
+//未指定名称的#Router可以映射到多个#RouterMap时，提示其他#RouterMap不会作为默认Map
+func selectRouterMaps(nodes []*nodeInfo, routerMapNodes []*nodeInfo) {
+	//key类型一致但没有被选择的Map -> 实际映射到的Map
+	shadowed := make(map[*nodeInfo]*mapType)
+	for _, node := range nodes {
+		if node.noteType != nodeTypeRouter || node.pRouterMap != nil {
+			continue
+		}
+		node.pRouterMap = routerMapNodes[0].pRouterMap
+		bNamed := false
+		if len(node.keys) > 0 {
+			for _, n := range routerMapNodes {
+				if n.pRouterMap.name == node.keys[0] {
+					node.pRouterMap = n.pRouterMap
+					node.keys = node.keys[1:]
+					bNamed = true
+					break
+				}
+			}
+		}
+		if bNamed {
+			if len(node.keys) == 0 {
+				report(severityWarning, node.position, "#Router 指定了Map %s 但没有指定常量", node.pRouterMap.name)
+			}
+			continue
+		}
+		//按常量类型选择Map
+		matched := make([]*nodeInfo, 0)
+		for _, n := range routerMapNodes {
+			if matchKeys(n.pRouterMap.keyType, node.keys) {
+				matched = append(matched, n)
+			}
+		}
+		if len(matched) == 0 {
+			continue
+		}
+		node.pRouterMap = matched[0].pRouterMap
+		for _, n := range matched[1:] {
+			if _, ok := shadowed[n]; !ok {
+				shadowed[n] = node.pRouterMap
+			}
+		}
+	}
+	for _, n := range routerMapNodes {
+		pMap, ok := shadowed[n]
+		if !ok {
+			continue
+		}
+		report(severityWarning, n.position, "#RouterMap 重复定义，未指定Map名称的#Router映射到 %s:%d 处定义的 %s，映射到 %s 需要使用 //#Router %s 常量名", pMap.position.Filename, pMap.position.Line, pMap.name, n.pRouterMap.name, n.pRouterMap.name)
+	}
+}
+
+//常量是否都是keyType类型，没有常量时返回false
+func matchKeys(keyType string, keys []string) bool {
+	for _, key := range keys {
+		if !checkKey(keyType, key) {
+			return false
+		}
+	}
+	return len(keys) > 0
+}
+
+//使用KeyValidator校验映射的常量，校验失败时报告错误并返回false
+func validateKey(node *nodeInfo, typeName, c string) bool {
+	if KeyValidator == nil {
+		return true
+	}
+	if err := KeyValidator(typeName, c); err != nil {
+		report(severityError, node.position, "常量 %s 校验失败：%s，忽略此映射", c, err.Error())
+		return false
+	}
+	return true
+}
+
+//是否是产生映射关系的注解，受选项AnnotationFiles限制
+func isRouteNote(t nodeType) bool {
+	switch t {
+	case nodeTypeRouter, nodeTypeMapping, nodeTypeRouterEach, nodeTypeMappingPair, nodeTypeRoute:
+		return true
+	}
+	return false
+}
+
+//文件中的映射注解是否生效，选项AnnotationFiles为空时全部生效
+//AnnotationFiles中的文件可以是文件名或相对于处理目录的路径，如 a.go、sub/a.go
+func isAnnotationFile(file string) bool {
+	if len(options.AnnotationFiles) == 0 {
+		return true
+	}
+	file = filepath.ToSlash(filepath.Clean(file))
+	for _, name := range options.AnnotationFiles {
+		name = filepath.ToSlash(filepath.Clean(name))
+		if file == name || strings.HasSuffix(file, "/"+name) {
+			return true
+		}
+	}
+	return false
+}
+
+//是否是修饰其他注解或声明的辅助注解，辅助注解不影响其他注解与声明的对应关系
+func isAuxNote(t nodeType) bool {
+	return t == nodeTypeDesc || t == nodeTypeRouterFallback || t == nodeTypeMappingPair || t == nodeTypePriority
+}
+
+//Map的值类型是否可以保存任意结构，标准库中的接口类型无法分析其方法集，交由编译器检查
+func acceptsStruct(pMap *mapType) bool {
+	return pMap.valueType == "interface{}" || pMap.valueType == "*interface{}" || pMap.valueStd
+}
+
+//处理#MappingPair注解，生成常量到请求结构与响应结构的映射
+//映射无效时返回nil，FailFast模式下结构类型与Map的值类型不一致时返回false中断处理
+func resolveMappingPair(node *nodeInfo, requestMap, responseMap *mapType) (*routeInfo, *routeInfo, bool) {
+	if len(node.keys) != 3 {
+		report(severityWarning, node.position, "#MappingPair 格式错误，应为 //#MappingPair 常量 请求结构 响应结构")
+		return nil, nil, true
+	}
+	c := node.keys[0]
+	if !validateKey(node, requestMap.keyType, c) {
+		return nil, nil, true
+	}
+	pairs := make([]*routeInfo, 0, 2)
+	for i, pMap := range []*mapType{requestMap, responseMap} {
+		name := node.keys[i+1]
+		st, ok := structList[name]
+		if !ok {
+			report(severityError, node.position, "#MappingPair 映射的结构 %s 未定义，忽略此映射", name)
+			return nil, nil, true
+		}
+		if !checkKey(pMap.keyType, c) {
+			report(severityWarning, node.position, "指定的常量 %s 未定义或者与映射Map %s 的key类型 %s 不一致", c, pMap.name, pMap.keyType)
+			return nil, nil, true
+		}
+		if !acceptsStruct(pMap) {
+			if options.FailFast {
+				report(severityError, st.position, "定义的结构【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，处理程序中断", st.name, pMap.position.Filename, pMap.position.Line, pMap.name, pMap.valueType)
+				return nil, nil, false
+			}
+			report(severityError, st.position, "定义的结构【%s】 与映射关系保存 Map【%s:%d %s】接受的值类型【%s】不一致，忽略此映射", st.name, pMap.position.Filename, pMap.position.Line, pMap.name, pMap.valueType)
+			return nil, nil, true
+		}
+		pairs = append(pairs, &routeInfo{
+			key:      c,
+			target:   st.name,
+			pMap:     pMap,
+			pNode:    node,
+			position: st.position,
+			desc:     st.desc,
+		})
+	}
+	return pairs[0], pairs[1], true
+}
+
+//获取注解后的第一个声明，跳过辅助注解，skipNotes为true时跳过所有注解
+func nextDecl(dList linesSort, i int, skipNotes bool) *declPos {
+	for j := i + 1; j < len(dList); j++ {
+		next := dList[j]
+		if next.pNode != nil && (skipNotes || isAuxNote(next.pNode.noteType)) {
+			continue
+		}
+		return next
+	}
+	return nil
+}
+
+//处理Map注解，记录注解后定义的map，Map已经定义或没有找到map定义时输出警告并返回false
+func resolveMapNote(node *nodeInfo, next *declPos, pMap **mapType, note string) bool {
+	if next.pMap == nil {
+		warnMapNotFound(node, next, note)
+		return false
+	}
+	if *pMap != nil {
+		report(severityWarning, node.position, "%s 重复定义， 已经定义在 %s:%d 处", note, (*pMap).position.Filename, (*pMap).position.Line)
+		return false
+	}
+	*pMap = next.pMap
+	return true
+}
+
+//方法反向映射使用的函数名称，方法使用 (*Controller).Handle 或 Controller.Handle 的格式
+func handlerName(fn *funcType) string {
+	if fn.recvType == "" {
+		return fn.funcName
+	}
+	if strings.HasPrefix(fn.recvType, "*") {
+		return "(" + fn.recvType + ")." + fn.funcName
+	}
+	return fn.recvType + "." + fn.funcName
+}
+
+//函数声明的名称，方法使用 接收者类型.方法名，指针接收者与值接收者的同名方法不能同时声明，不区分两者
+func funcDeclKey(fn *funcType) string {
+	if fn.recvType == "" {
+		return fn.funcName
+	}
+	return strings.TrimPrefix(fn.recvType, "*") + "." + fn.funcName
+}
+
+//检查映射的函数是否只有一个声明，生成的代码按名称引用函数，不同构建标签的文件或子目录中同包名的文件中的同名函数会使映射目标不明确
+//同一函数映射了多个常量时只报告一次
+func checkAmbiguousTargets(pendingList []*nodeInfo) {
+	reported := make(map[string]bool)
+	for _, node := range pendingList {
+		if node.pFunc == nil {
+			continue
+		}
+		key := funcDeclKey(node.pFunc)
+		positions := funcDecls[key]
+		if len(positions) < 2 || reported[key] {
+			continue
+		}
+		reported[key] = true
+		places := make([]string, 0, len(positions))
+		for _, position := range positions {
+			places = append(places, fmt.Sprintf("%s:%d", position.Filename, position.Line))
+		}
+		report(severityWarning, node.position, "映射的函数 %s 有 %d 个同名声明（%s），生成的代码引用的函数不明确，请检查构建标签或子目录中同包名的文件", handlerName(node.pFunc), len(positions), strings.Join(places, "，"))
+	}
+}
+
+//描述注解之后实际找到的声明，用于说明注解为什么没有对应的定义，如 ，注解之后是结构 SSS
+func foundDecl(next *declPos) string {
+	kind := ""
+	switch {
+	case next.pFunc != nil:
+		kind = "函数 " + handlerName(next.pFunc)
+	case next.pStruct != nil:
+		kind = "结构 " + next.pStruct.name
+	case next.pMap != nil:
+		kind = "Map " + next.pMap.name
+	case next.pSlice != nil:
+		kind = "切片 " + next.pSlice.name
+	case len(next.consts) > 0:
+		kind = "常量 " + next.consts[0]
+	case next.varName != "":
+		kind = "变量 " + next.varName
+	default:
+		return ""
+	}
+	return "，注解之后是" + kind
+}
+
+//Map注解后没有找到有效的map定义时输出诊断信息
+func warnMapNotFound(node *nodeInfo, next *declPos, note string) {
+	if next.varName == "_" {
+		report(severityWarning, node.position, "%s 注释的变量是空白标识符 _，生成的代码无法引用", note)
+		return
+	}
+	if next.varName != "" {
+		report(severityWarning, node.position, "%s 必须是 map 类型，变量 %s 不是 map 类型", note, next.varName)
+		return
+	}
+	report(severityWarning, node.position, "%s 没有找到有效的map定义%s", note, foundDecl(next))
+}
+
+//检查常量是否已经映射到同一个Map中，重复映射时保留先出现的映射关系
+func checkDuplicate(routedKeys map[string]*routeInfo, route *routeInfo) bool {
+	id := route.pMap.name + "." + route.key
+	if exist, ok := routedKeys[id]; ok {
+		report(severityWarning, route.pNode.position, "常量 %s 重复映射到 %s，已经在 %s:%d 处映射到 %s", route.key, route.pMap.name, exist.pNode.position.Filename, exist.pNode.position.Line, exist.target)
+		return false
+	}
+	routedKeys[id] = route
+	return true
+}
+
+//映射关系所属的输出文件
+func outputFileName(route *routeInfo, mapping bool) string {
+	return outputFor(route.pNode.position, mapping)
+}
+
+//注解所在位置对应的输出文件，mapping表示是否是结构映射生成的代码
+//测试文件中注解生成的代码输出到_test.go文件，避免测试代码中的映射被编译到正式代码中
+func outputFor(position token.Position, mapping bool) string {
+	output := options.Output
+	if options.SplitOutput {
+		output = options.RouterOutput
+		if mapping {
+			output = options.MappingOutput
+		}
+	}
+	if options.PerFile {
+		base := filepath.Base(position.Filename)
+		return strings.TrimSuffix(output, ".go") + "_" + base
+	}
+	if strings.HasSuffix(position.Filename, "_test.go") {
+		return strings.TrimSuffix(output, ".go") + "_test.go"
+	}
+	return output
+}
+
+//单文件输出时总是生成的文件
+func defaultOutputs() []string {
+	if options.SplitOutput {
+		return []string{options.RouterOutput, options.MappingOutput}
+	}
+	return []string{options.Output}
+}
+
+//生成映射赋值代码
+func renderAssign(route *routeInfo) string {
+	return fmt.Sprintf("%s[%s] = %s", qualify(route.pMap.name), qualify(route.key), qualify(route.target))
+}
+
+//映射到其他包中的设置函数时生成函数调用，如 framework.SetHandler(Const1, f1)，其他映射使用render生成
+func renderSetter(render func(route *routeInfo) string) func(route *routeInfo) string {
+	return func(route *routeInfo) string {
+		if route.pMap.external {
+			return fmt.Sprintf("%s(%s, %s)", route.pMap.name, qualify(route.key), qualify(route.target))
+		}
+		return render(route)
+	}
+}
+
+//是否是其他包中的设置函数注解，如 //#RouterMap external:framework.SetHandler
+func isExternalMap(text string) bool {
+	fields := strings.Fields(text)
+	return len(fields) == 2 && strings.ToUpper(fields[0]) == strings.ToUpper("//#RouterMap") && strings.HasPrefix(fields[1], "external:")
+}
+
+//解析其他包中的设置函数，格式错误时返回nil
+//包名之前可以带有导入路径，如 external:example.com/framework.SetHandler，生成的代码导入该路径
+func parseExternalMap(text string, position token.Position) *mapType {
+	setter := strings.TrimPrefix(strings.Fields(text)[1], "external:")
+	dot := strings.LastIndex(setter, ".")
+	pkgPath, name := setter[:dot+1], setter[dot+1:]
+	pkgPath = strings.TrimSuffix(pkgPath, ".")
+	pkg := path.Base(pkgPath)
+	if !token.IsIdentifier(pkg) || !token.IsIdentifier(name) {
+		report(severityWarning, position, "#RouterMap 设置函数 %s 格式错误，应为 external:包名.函数名", setter)
+		return nil
+	}
+	if strings.Contains(pkgPath, "/") {
+		recordImport(pkg, strconv.Quote(pkgPath))
+	}
+	return &mapType{position: position, name: pkg + "." + name, external: true}
+}
+
+//设置函数的key，需要是定义的常量、字面量或其他包中的常量
+func isExternalKey(key string) bool {
+	if _, ok := constList[key]; ok {
+		return true
+	}
+	pkg, name, ok := strings.Cut(key, ".")
+	return isLiteralKey(key) || isCompositeKey(key) || ok && token.IsIdentifier(pkg) && token.IsIdentifier(name)
+}
+
+//生成调用Add方法添加映射的代码，如 m.Add(Const1, f1)
+func renderAddAssign(route *routeInfo) string {
+	return fmt.Sprintf("%s.%s(%s, %s)", qualify(route.pMap.name), options.AddMethod, qualify(route.key), qualify(route.target))
+}
+
+//生成调用Add方法添加结构映射的代码，如 mm.Add(Const1, SSS{})
+func renderAddStruct(route *routeInfo) string {
+	return fmt.Sprintf("%s.%s(%s, %s)", qualify(route.pMap.name), options.AddMethod, qualify(route.key), structValue(route))
+}
+
+//生成调用泛型注册函数保存映射的代码，如 Register[Cmd, func()](m, CmdA, fa)
+//显式指定类型参数，值类型是接口时类型推导无法通过
+func renderRegisterAssign(route *routeInfo) string {
+	return fmt.Sprintf("%s[%s, %s](%s, %s, %s)", options.RegisterFunc, qualify(route.pMap.keyType), qualify(route.pMap.valueType), qualify(route.pMap.name), qualify(route.key), qualify(route.target))
+}
+
+//生成调用泛型注册函数保存结构映射的代码，如 Register[Cmd, interface{}](mm, CmdA, SSS{})
+func renderRegisterStruct(route *routeInfo) string {
+	return fmt.Sprintf("%s[%s, %s](%s, %s, %s)", options.RegisterFunc, qualify(route.pMap.keyType), qualify(route.pMap.valueType), qualify(route.pMap.name), qualify(route.key), structValue(route))
+}
+
+//目标Go版本是否不低于1.minor，版本格式如 1.17、go1.21.3，无法解析时按默认版本处理
+func goVersionAtLeast(minor int) bool {
+	m, ok := goMinorVersion(options.GoVersion)
+	if !ok {
+		m, _ = goMinorVersion(baseGoVersion)
+	}
+	return m >= minor
+}
+
+//解析Go版本的次版本号，如 1.18 返回 18
+func goMinorVersion(version string) (int, bool) {
+	parts := strings.Split(strings.TrimPrefix(version, "go"), ".")
+	if len(parts) < 2 || parts[0] != "1" {
+		return 0, false
+	}
+	m, err := strconv.Atoi(parts[1])
+	return m, err == nil
+}
+
+//生成泛型注册函数
+func renderRegisterFunc() string {
+	lines := []string{
+		fmt.Sprintf("//%s 保存映射关系，生成的映射都通过此函数注册", options.RegisterFunc),
+		fmt.Sprintf("func %s[K comparable, V any](m map[K]V, k K, v V) {", options.RegisterFunc),
+		"\tm[k] = v",
+		"}",
+	}
+	return strings.Join(lines, "\r\n") + "\r\n"
+}
+
+//生成切片赋值代码
+func renderSlice(route *routeInfo) string {
+	return fmt.Sprintf("%s = %s", qualify(route.pMap.name), qualify(route.target))
+}
+
+//生成结构映射赋值代码
+func renderStruct(route *routeInfo) string {
+	return fmt.Sprintf("%s[%s] = %s", qualify(route.pMap.name), qualify(route.key), structValue(route))
+}
+
+//结构映射保存的值，#MappingPtr 映射时为结构指针，如 &SSS{}，指定了初始化字段时为 SSS{Retries: 3}
+//选项ReflectNew为true时使用反射创建结构指针，Map的值类型是标准库中的接口时断言为该接口，指定了初始化字段时使用 &SSS{Retries: 3}
+func structValue(route *routeInfo) string {
+	init := "{}"
+	if route.pNode != nil && route.pNode.init != "" {
+		init = route.pNode.init
+	}
+	if route.pointer || options.ReflectNew && init != "{}" {
+		return "&" + qualify(route.target) + init
+	}
+	if options.ReflectNew {
+		value := "reflect.New(reflect.TypeOf(" + qualify(route.target) + "{})).Interface()"
+		if route.pMap.valueStd {
+			value += ".(" + route.pMap.valueType + ")"
+		}
+		return value
+	}
+	return qualify(route.target) + init
+}
+
+//分离#Mapping 注解中的结构初始化字段，以 { 开始的部分作为初始化字段，如 {Retries: 3, Name: "a"}
+//初始化字段需要是有效的复合字面量，格式错误或者指定了多个时报告警告并忽略
+func splitStructInit(keys []string, position token.Position) ([]string, string) {
+	consts := make([]string, 0, len(keys))
+	init := ""
+	for _, key := range keys {
+		if !strings.HasPrefix(key, "{") {
+			consts = append(consts, key)
+			continue
+		}
+		if init != "" {
+			report(severityWarning, position, "#Mapping 只能指定一个结构初始化字段，忽略 %s", key)
+			continue
+		}
+		expr, err := parser.ParseExpr("T" + key)
+		if _, ok := expr.(*ast.CompositeLit); err != nil || !ok {
+			report(severityWarning, position, "#Mapping 结构初始化字段 %s 格式错误，忽略此初始化", key)
+			continue
+		}
+		init = key
+	}
+	return consts, init
+}
+
+//按输出文件对代码段分组，每个输出文件只包含属于它的映射关系
+func groupByOutput(sections []*codeSection) map[string][]*codeSection {
+	groups := make(map[string][]*codeSection)
+	for _, section := range sections {
+		parts := make(map[string]*codeSection)
+		for _, route := range section.routes {
+			name := outputFileName(route, section.mapping)
+			part, ok := parts[name]
+			if !ok {
+				part = &codeSection{name: section.name, render: section.render, mapping: section.mapping}
+				parts[name] = part
+				groups[name] = append(groups[name], part)
+			}
+			part.routes = append(part.routes, route)
+		}
+	}
+	return groups
+}
+
+//生成保存映射关系的init函数及其他声明的代码
+func buildInitSource(sections []*codeSection, decls []*codeDecl) string {
+	header := "package " + outputPackageName() + "\r\n//" + generatedMarker + "，请不要随意修改!\r\n"
+	funcBody := ""
+	bInit := len(sections) > 0 || len(decls) == 0
+	//输出到其他包时引用处理的包
+	imports := make([]string, 0)
+	if crossPackage() && (len(sections) > 0 || len(decls) > 0) {
+		imports = append(imports, qualifiedImport())
+	}
+	//延迟生成映射时使用sync.Once
+	lazy := &codeDecl{}
+	if options.LazyInit && bInit {
+		lazy.imports = []string{strconv.Quote("sync")}
+	}
+	//使用反射创建结构映射的值
+	reflected := &codeDecl{}
+	routerText, mappingText := "", ""
+	if bInit {
+		indent := "\t"
+		if options.LazyInit {
+			funcBody += "\r\nvar " + options.OnceName + " sync.Once\r\n"
+			funcBody += "\r\n//" + options.EnsureName + " 生成映射关系，多次调用时只生成一次\r\n"
+			funcBody += "func " + options.EnsureName + "() {\r\n\t" + options.OnceName + ".Do(func() {\r\n"
+			indent = "\t\t"
+		} else {
+			funcBody += "\r\nfunc init() {\r\n"
+		}
+		for i, section := range sections {
+			if i > 0 {
+				funcBody += "\r\n"
+			}
+			text := indent + "//" + section.name + "\r\n"
+			for _, route := range section.routes {
+				text += indent + section.render(route) + "\r\n"
+			}
+			text += indent + "//" + section.name + "结束\r\n"
+			if section.mapping {
+				mappingText += text
+			} else {
+				routerText += text
+			}
+			funcBody += text
+		}
+		if options.LazyInit {
+			funcBody += "\t})\r\n"
+		}
+		funcBody += "}\r\n"
+	}
+	for _, decl := range decls {
+		funcBody += "\r\n" + decl.code
+	}
+	//单文件输出时分别记录方法映射与结构映射的Hash，重新生成时据此判断变化的部分
+	if !options.SplitOutput && bInit {
+		funcBody += "\r\n//" + routerHashLabel + md5Hex(routerText) + "\r\n//" + mappingHashLabel + md5Hex(mappingText) + "\r\n"
+	}
+	//生成代码中引用的其他包，如 Map值类型中的 context.Context、其他包中的常量 pb.OpLogin
+	referenced := &codeDecl{imports: referencedImports(header + funcBody)}
+	if options.ReflectNew && strings.Contains(mappingText, "reflect.New(") {
+		reflected.imports = []string{strconv.Quote("reflect")}
+	}
+	for _, decl := range append([]*codeDecl{lazy, reflected, referenced}, decls...) {
+		for _, spec := range decl.imports {
+			exist := false
+			for _, s := range imports {
+				exist = exist || s == spec
+			}
+			if !exist {
+				imports = append(imports, spec)
+			}
+		}
+	}
+	sort.Strings(imports)
+	if len(imports) == 1 {
+		header += "\r\nimport " + imports[0] + "\r\n"
+	} else if len(imports) > 1 {
+		header += "\r\nimport (\r\n\t" + strings.Join(imports, "\r\n\t") + "\r\n)\r\n"
+	}
+	return header + funcBody
+}
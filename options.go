@@ -0,0 +1,129 @@
+package noteRouter
+
+//默认生成的映射文件名
+const automationFile = "NodeRouterAutomation.go"
+
+//按映射类型拆分输出时的默认文件名
+const (
+	routerFile  = "router_gen.go"
+	mappingFile = "mapping_gen.go"
+)
+
+//默认的生成代码目标Go版本，不使用泛型等新版本的语法
+const baseGoVersion = "1.17"
+
+//生成文件的标记，只有包含此标记的文件才会被覆盖
+const generatedMarker = "NoteRouter自动生成文件"
+
+//生成选项
+type Options struct {
+	Output   string //生成的映射文件名
+	PerFile  bool   //按源文件分别生成映射文件，每个源文件的映射保存在各自文件的init函数中
+	FailFast bool   //遇到类型不一致时立即中断处理，为false时报告全部不一致的映射并继续生成有效的映射
+
+	SplitOutput   bool   //按映射类型拆分输出文件，方法映射与结构映射分别生成到各自的文件中，每个文件有独立的init函数与Hash
+	RouterOutput  string //拆分输出时方法映射、名称映射生成的文件名
+	MappingOutput string //拆分输出时结构映射、结构反向映射生成的文件名
+
+	OutputDir     string //映射文件的输出目录，相对于处理的目录，为空时输出到处理的目录
+	OutputPackage string //映射文件的包名，与处理的包不同时生成代码使用包名限定引用的常量、函数与结构，并生成import
+	ImportPath    string //处理的包的导入路径，映射文件输出到其他包时必须指定
+
+	Mode DispatchMode //方法映射的生成方式，默认在init函数中保存到#RouterMap中
+
+	ValidateRoutes bool //生成 ValidateRoutes 函数，运行时检查#RouterMap中是否包含key类型全部常量的映射
+	RouteCoverage  bool //生成 RouteCoverage 变量，记录#RouterMap的key类型的常量总数与已映射的常量数量
+
+	LazyInit   bool   //不生成init函数，映射关系在首次调用 EnsureName 函数时使用sync.Once生成，重复调用是安全的
+	OnceName   string //LazyInit 模式生成的sync.Once变量名
+	EnsureName string //LazyInit 模式生成的函数名
+
+	AnnotationPrefix string //注解标记前的包裹符号，如 [ 时可以使用 //[#Router Const1] 的注解格式
+	AnnotationSuffix string //注解标记后的包裹符号，如 ]
+
+	SkipTestFiles bool     //不处理_test.go文件，为false时测试文件中的映射生成到单独的_test.go文件中
+	Exclude       []string //不处理的目录或文件，可以是名称或者相对于处理目录的glob模式，如 vendor、internal/*、*_gen.go，匹配的目录不再递归处理
+
+	AnnotationFiles []string //只处理指定文件中的#Router、#Mapping等映射注解，其他文件仍然解析，其中的声明可以被映射，为空时处理全部文件
+
+	RequireExported bool //要求#Router映射的函数都是导出的，映射未导出的函数时报告错误
+	Adapters        bool //函数签名与#RouterMap的值类型不一致但可以转换时生成适配函数，如将 func(Req) Resp 适配为 func(interface{}) interface{}
+	ReflectNew      bool //使用 reflect.New(reflect.TypeOf(SSS{})).Interface() 生成#Mapping 映射的结构，每个映射保存新创建的结构指针 *SSS，自动导入reflect
+	TypeAssertions  bool //为每个映射函数生成 var _ 值类型 = 函数 的编译期检查，类型不一致时只报告警告，由编译器在映射函数的位置报告错误
+
+	NameTransform NameTransform //名称映射生成名称时使用的转换方式
+	NamePrefix    string        //名称映射生成名称时去除的常量名前缀，如 Cmd
+
+	Newline string //生成文件使用的换行符，\n 或 \r\n，为空时使用 \n
+
+	GoVersion    string    //生成代码的目标Go版本，如 1.17、1.18，低于1.18时不生成泛型代码
+	SortOrder    SortOrder //生成的映射关系的排列顺序
+	RegisterFunc string    //泛型注册函数名，如 Register，指定时生成 func Register[K comparable, V any](m map[K]V, k K, v V) 并通过它保存所有映射，需要Go 1.18以上
+	AddMethod    string    //有序Map的添加方法名，如 Add，指定时生成 m.Add(Const1, f1) 代替 m[Const1] = f1，用于#RouterMap与#MappingMap是保持插入顺序的有序Map的情况
+
+	PackageMismatchPolicy PackageMismatchPolicy //文件的包名与先处理的文件不一致时的处理方式
+
+	PrintDiagnostics bool   //将诊断信息输出到标准输出，为false时只能通过 Diagnostics 获取
+	DiagnosticsFile  string //诊断信息文件，指定时将诊断信息以JSON数组的格式写入此文件，每项包含 file、line、severity、message，用于CI集成
+}
+
+//方法映射的生成方式
+type DispatchMode int
+
+const (
+	MapInit        DispatchMode = iota //在init函数中将映射保存到#RouterMap中
+	SwitchDispatch                     //为每个#RouterMap生成使用switch分派的函数，如 mDispatch(key Cmd) func()，映射不可修改，Map中不保存映射
+)
+
+//包名不一致时的处理方式
+type PackageMismatchPolicy int
+
+const (
+	PackageMismatchDefault PackageMismatchPolicy = iota //处理单个目录时跳过，多个目录合并处理时报告错误并中断
+	PackageMismatchSkip                                 //跳过包名不一致的文件
+	PackageMismatchWarn                                 //报告警告并跳过包名不一致的文件
+	PackageMismatchError                                //报告错误并中断处理
+)
+
+//映射关系的排列顺序
+type SortOrder int
+
+const (
+	SortByKey      SortOrder = iota //按常量值排列，常量值无法计算时按常量声明顺序排列
+	SortByTarget                    //按映射目标名称排列，同一处理函数的映射排列在一起
+	SortByPosition                  //按映射目标在源码中的位置排列
+	SortByPriority                  //按映射目标的#Priority注解从小到大排列，优先级相同时按key的顺序排列
+)
+
+//默认生成选项
+func DefaultOptions() Options {
+	return Options{
+		Output:   automationFile,
+		FailFast: true,
+
+		RouterOutput:  routerFile,
+		MappingOutput: mappingFile,
+
+		OnceName:   "routesOnce",
+		EnsureName: "ensureRoutes",
+
+		AnnotationPrefix: "[",
+		AnnotationSuffix: "]",
+
+		SkipTestFiles: true,
+		Exclude:       []string{"vendor", "testdata"},
+
+		Newline: "\n",
+
+		GoVersion: baseGoVersion,
+
+		PrintDiagnostics: true,
+	}
+}
+
+//当前使用的生成选项
+var options = DefaultOptions()
+
+//自定义的常量校验函数，生成映射时对每个映射的常量调用，返回错误时报告错误并忽略此映射
+//可以用于检查常量命名规则，如要求常量名以 Cmd 开头
+var KeyValidator func(typeName, constName string) error
@@ -0,0 +1,238 @@
+package noteRouter
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+//映射文件是否输出到与处理的包不同的包中
+func crossPackage() bool {
+	return options.OutputPackage != "" && options.OutputPackage != packageName
+}
+
+//映射文件的包名
+func outputPackageName() string {
+	if options.OutputPackage != "" {
+		return options.OutputPackage
+	}
+	return packageName
+}
+
+//输出到其他包时引用处理的包的import项，导入路径的最后一段与包名不同时使用包名作为引用名
+func qualifiedImport() string {
+	if path.Base(options.ImportPath) == packageName {
+		return strconv.Quote(options.ImportPath)
+	}
+	return packageName + " " + strconv.Quote(options.ImportPath)
+}
+
+//是否是处理的包中声明的标识符
+func isPackageIdent(name string) bool {
+	if _, ok := constList[name]; ok {
+		return true
+	}
+	if _, ok := structList[name]; ok {
+		return true
+	}
+	if _, ok := funcList[name]; ok {
+		return true
+	}
+	if _, ok := mapList[name]; ok {
+		return true
+	}
+	if _, ok := sliceList[name]; ok {
+		return true
+	}
+	if _, ok := namedFuncList[name]; ok {
+		return true
+	}
+	for _, t := range typeList {
+		if t.typeName == name {
+			return true
+		}
+	}
+	return false
+}
+
+//输出到其他包时使用包名限定表达式中引用的处理的包中的标识符，如 Const1 生成为 pkg.Const1，SSS{} 生成为 pkg.SSS{}
+//表达式无法解析时原样返回
+func qualify(expr string) string {
+	if !crossPackage() {
+		return expr
+	}
+	fSet := token.NewFileSet()
+	x, err := parser.ParseExprFrom(fSet, "", expr, 0)
+	if err != nil {
+		return expr
+	}
+	offsets := make([]int, 0)
+	collectIdents(x, fSet, &offsets)
+	//从后向前插入包名，避免插入位置偏移
+	sort.Sort(sort.Reverse(sort.IntSlice(offsets)))
+	for _, offset := range offsets {
+		expr = expr[:offset] + packageName + "." + expr[offset:]
+	}
+	return expr
+}
+
+//收集表达式中需要使用包名限定的标识符位置
+func collectIdents(x ast.Node, fSet *token.FileSet, offsets *[]int) {
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch t := n.(type) {
+		case *ast.SelectorExpr: //已经限定的标识符只处理包名部分
+			collectIdents(t.X, fSet, offsets)
+			return false
+		case *ast.Field: //参数名不需要限定
+			collectIdents(t.Type, fSet, offsets)
+			return false
+		case *ast.CompositeLit: //结构字面量中的字段名不需要限定
+			if t.Type != nil {
+				collectIdents(t.Type, fSet, offsets)
+			}
+			ident, _ := t.Type.(*ast.Ident)
+			for _, elt := range t.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok && ident != nil {
+					if _, ok := structList[ident.Name]; ok {
+						collectIdents(kv.Value, fSet, offsets)
+						continue
+					}
+				}
+				collectIdents(elt, fSet, offsets)
+			}
+			return false
+		case *ast.Ident:
+			if isPackageIdent(t.Name) {
+				*offsets = append(*offsets, fSet.Position(t.Pos()).Offset)
+			}
+		}
+		return true
+	})
+}
+
+//获取表达式中引用的处理的包中未导出的标识符
+func unexportedIdents(expr string) []string {
+	fSet := token.NewFileSet()
+	x, err := parser.ParseExprFrom(fSet, "", expr, 0)
+	if err != nil {
+		return nil
+	}
+	offsets := make([]int, 0)
+	collectIdents(x, fSet, &offsets)
+	names := make([]string, 0)
+	for _, offset := range offsets {
+		name := expr[offset:]
+		if end := strings.IndexFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' }); end >= 0 {
+			name = name[:end]
+		}
+		if !ast.IsExported(name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+//输出到其他包时检查映射关系引用的标识符是否都已导出，引用了未导出标识符的映射关系无法编译，报告错误并忽略
+func checkExported(sections []*codeSection) {
+	if !crossPackage() {
+		return
+	}
+	for _, section := range sections {
+		routes := make([]*routeInfo, 0, len(section.routes))
+		for _, route := range section.routes {
+			refs := []string{route.pMap.name, route.pMap.keyType, route.pMap.valueType, route.key, route.target}
+			//映射函数的参数与返回值类型
+			if route.pNode.pFunc != nil && route.pNode.pFunc.funcName == route.target {
+				refs = append(refs, route.pNode.pFunc.typeString)
+			}
+			unexported := make([]string, 0)
+			for _, ref := range refs {
+				for _, name := range unexportedIdents(ref) {
+					if !containsString(unexported, name) {
+						unexported = append(unexported, name)
+					}
+				}
+			}
+			if len(unexported) == 0 {
+				routes = append(routes, route)
+				continue
+			}
+			position := route.position
+			if position.Filename == "" {
+				position = route.pNode.position
+			}
+			report(severityError, position, "映射 %s[%s] = %s 引用了未导出的标识符 %s，输出到包 %s 时无法访问，忽略此映射", route.pMap.name, route.key, route.target, strings.Join(unexported, ", "), options.OutputPackage)
+		}
+		section.routes = routes
+	}
+}
+
+//输出到其他包时检查输出包中是否声明了与处理的包名或映射的Map同名的包级标识符
+//与包名同名时生成代码中包名限定的引用无法指向处理的包，与Map同名时输出包中的代码引用的不是生成代码填充的Map
+func checkShadowed(sections []*codeSection, dir string) {
+	if !crossPackage() {
+		return
+	}
+	maps := make(map[string]bool)
+	for _, section := range sections {
+		for _, route := range section.routes {
+			maps[route.pMap.name] = true
+		}
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	sort.Strings(files)
+	fSet := token.NewFileSet()
+	for _, file := range files {
+		f, err := parser.ParseFile(fSet, file, nil, parser.ParseComments)
+		if err != nil || f.Name.Name != options.OutputPackage || isGeneratedAST(f, fSet) {
+			continue
+		}
+		for _, ident := range packageScopeIdents(f) {
+			switch {
+			case ident.Name == packageName:
+				report(severityWarning, fSet.Position(ident.Pos()), "输出包 %s 中声明的 %s 与处理的包名相同，生成代码中 %s.X 形式的引用无法指向包 %s", options.OutputPackage, ident.Name, packageName, options.ImportPath)
+			case maps[ident.Name]:
+				report(severityWarning, fSet.Position(ident.Pos()), "输出包 %s 中声明的 %s 与映射的Map同名，生成代码填充的是 %s.%s，输出包中引用 %s 时不会得到映射关系", options.OutputPackage, ident.Name, packageName, ident.Name, ident.Name)
+			}
+		}
+	}
+}
+
+//文件中声明的包级标识符
+func packageScopeIdents(f *ast.File) []*ast.Ident {
+	idents := make([]*ast.Ident, 0)
+	for _, decl := range f.Decls {
+		switch d := decl.(type) {
+		case *ast.FuncDecl:
+			if d.Recv == nil {
+				idents = append(idents, d.Name)
+			}
+		case *ast.GenDecl:
+			for _, spec := range d.Specs {
+				switch sp := spec.(type) {
+				case *ast.ValueSpec:
+					idents = append(idents, sp.Names...)
+				case *ast.TypeSpec:
+					idents = append(idents, sp.Name)
+				}
+			}
+		}
+	}
+	return idents
+}
+
+//字符串列表中是否包含指定的字符串
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,17 @@
 package noteRouter
 
 import (
+	"encoding/json"
 	"fmt"
-	"reflect"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -25,11 +34,26 @@ var m = make(map[ConstType]func())
 //#MappingMap
 var mm = make(map[ConstType]interface{})
 
+//测试文件中的注解只生成到_test.go文件中
 func TestParser(t *testing.T) {
-	m[Const1]()
-	m[Const2]()
-	m[Const3]()
-	fmt.Printf("The struct is %s\r\n", reflect.TypeOf(mm[Const1]).Name())
+	resetState()
+	options.SkipTestFiles = false
+	defer func() {
+		options = DefaultOptions()
+	}()
+	var sources map[string]string
+	output := captureOutput(t, func() {
+		sources, _ = generateSource(".")
+	})
+	if _, ok := sources[automationFile]; ok {
+		t.Errorf("测试文件中的映射不应生成到 %s\n%s", automationFile, output)
+	}
+	source := sources["NodeRouterAutomation_test.go"]
+	for _, want := range []string{"m[Const1] = f1", "m[Const2] = f2", "m[Const3] = f2", "mm[Const1] = SSS{}"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
 }
 
 func UnaryExpr(t testing.T, i map[string]interface{}, a ...interface{}) (int, error) {
@@ -50,3 +74,4890 @@ func f2() {
 type SSS struct {
 
 }
+
+//在临时目录中写入测试源文件并生成映射代码，返回生成的代码与输出信息
+func generateFixture(t *testing.T, files map[string]string) (string, string) {
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	return sources[automationFile], output
+}
+
+//使用指定的选项生成测试源文件的映射代码，返回输出文件名与代码的对应关系及输出信息
+func generateFixtureWith(t *testing.T, opts Options, files map[string]string) (map[string]string, string) {
+	dir := writeFixture(t, files)
+	resetState()
+	options = opts
+	defer func() {
+		options = DefaultOptions()
+	}()
+	var sources map[string]string
+	output := captureOutput(t, func() {
+		sources, _ = generateSource(dir)
+	})
+	return sources, output
+}
+
+//捕获标准输出
+func captureOutput(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() {
+		os.Stdout = stdout
+	}()
+	fn()
+	w.Close()
+	data, _ := io.ReadAll(r)
+	return string(data)
+}
+
+func TestContextFirstHandler(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+import "context"
+
+type Cmd int
+
+const (
+	CmdLogin Cmd = iota
+	CmdLogout
+)
+
+type Req struct{}
+type Resp struct{}
+
+type Handler func(ctx context.Context, req Req) (Resp, error)
+
+//#RouterMap
+var handlers = make(map[Cmd]Handler)
+`,
+		"b.go": `package fixture
+
+import (
+	"context"
+	gocontext "context"
+)
+
+//#Router CmdLogin
+func login(ctx gocontext.Context, req Req) (Resp, error) {
+	return Resp{}, nil
+}
+
+//#Router CmdLogout
+func logout(ctx context.Context, req Req) (Resp, error) {
+	return Resp{}, nil
+}
+`,
+	})
+	for _, want := range []string{"handlers[CmdLogin] = login", "handlers[CmdLogout] = logout"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestContextFirstHandlerUnnamedType(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+import ctx "context"
+
+type Cmd int
+
+const (
+	CmdLogin Cmd = iota
+)
+
+type Req struct{}
+type Resp struct{}
+
+//#RouterMap
+var handlers = make(map[Cmd]func(ctx.Context, Req) (Resp, error))
+
+//#Router CmdLogin
+func login(c ctx.Context, req Req) (Resp, error) {
+	return Resp{}, nil
+}
+`,
+	})
+	if !strings.Contains(source, "handlers[CmdLogin] = login") {
+		t.Errorf("生成代码缺少 handlers[CmdLogin] = login\n%s%s", source, output)
+	}
+}
+
+func TestBlankIdentifierConst(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	_ Cmd = iota
+	CmdA
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router _ CmdA
+func fa() {}
+
+//#Router CmdB
+func fb() {}
+`,
+	})
+	if strings.Contains(source, "m[_]") {
+		t.Errorf("空白标识符不应作为映射常量\n%s", source)
+	}
+	if !strings.Contains(output, "指定的常量 _ 未定义") {
+		t.Errorf("缺少空白标识符的警告: %s", output)
+	}
+	for _, want := range []string{"m[CmdA] = fa", "m[CmdB] = fb"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if !checkConst("Cmd", "CmdA") || checkConst("Cmd", "_") {
+		t.Errorf("常量列表记录错误: %v", typeList[0].constValues)
+	}
+}
+
+func TestStdInterfaceMappingMap(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+import (
+	"io"
+)
+
+type Cmd int
+
+const (
+	CmdStdout Cmd = iota
+	CmdDiscard
+)
+
+//#MappingMap
+var writers = make(map[Cmd]io.Writer)
+
+//#Mapping CmdStdout CmdDiscard
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+`,
+	})
+	if strings.Contains(output, "不一致") {
+		t.Errorf("标准库接口类型不应判定为类型不一致: %s", output)
+	}
+	for _, want := range []string{"writers[CmdStdout] = nopWriter{}", "writers[CmdDiscard] = nopWriter{}"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestPerFileOutput(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PerFile = true
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"b.go": `package fixture
+
+//#Router CmdB
+func fb() {}
+`,
+	})
+	if len(sources) != 2 {
+		t.Fatalf("应生成2个映射文件，实际生成 %d 个\n%s", len(sources), output)
+	}
+	for name, want := range map[string]string{
+		"NodeRouterAutomation_a.go": "m[CmdA] = fa",
+		"NodeRouterAutomation_b.go": "m[CmdB] = fb",
+	} {
+		source := sources[name]
+		if !strings.Contains(source, want) || !strings.Contains(source, "func init()") {
+			t.Errorf("%s 缺少 %q\n%s", name, want, source)
+		}
+	}
+	if strings.Contains(sources["NodeRouterAutomation_a.go"], "= fb") {
+		t.Errorf("b.go 的映射不应出现在 a.go 的映射文件中")
+	}
+}
+
+const splitOutputFixture = `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Router CmdA
+func fa() {}
+
+//#Mapping CmdB
+type SB struct{}
+`
+
+func TestSplitOutput(t *testing.T) {
+	opts := DefaultOptions()
+	opts.SplitOutput = true
+	sources, output := generateFixtureWith(t, opts, map[string]string{"a.go": splitOutputFixture})
+	if len(sources) != 2 {
+		t.Fatalf("应生成2个映射文件，实际生成 %d 个\n%s", len(sources), output)
+	}
+	router, mapping := sources[routerFile], sources[mappingFile]
+	if !strings.Contains(router, "m[CmdA] = fa") || strings.Contains(router, "SB") {
+		t.Errorf("%s 应只包含方法映射\n%s", routerFile, router)
+	}
+	if !strings.Contains(mapping, "mm[CmdB] = SB{}") || strings.Contains(mapping, "fa") {
+		t.Errorf("%s 应只包含结构映射\n%s", mappingFile, mapping)
+	}
+	for name, source := range sources {
+		if !strings.Contains(source, "func init()") {
+			t.Errorf("%s 缺少init函数\n%s", name, source)
+		}
+	}
+
+	//只修改结构映射时方法映射文件不需要重新生成
+	dir := t.TempDir()
+	output = captureOutput(t, func() { writeSources(dir, sources) })
+	for _, name := range []string{routerFile, mappingFile} {
+		if !strings.Contains(output, name) {
+			t.Errorf("首次生成时应生成 %s\n%s", name, output)
+		}
+	}
+	sources, _ = generateFixtureWith(t, opts, map[string]string{"a.go": strings.Replace(splitOutputFixture, "type SB", "type SC struct{}\n\n//#Mapping CmdA\ntype SB", 1)})
+	output = captureOutput(t, func() { writeSources(dir, sources) })
+	if strings.Contains(output, routerFile) || !strings.Contains(output, mappingFile) {
+		t.Errorf("只有 %s 应重新生成\n%s", mappingFile, output)
+	}
+}
+
+func TestWrittenSourceFormatted(t *testing.T) {
+	opts := DefaultOptions()
+	opts.ValidateRoutes = true
+	sources, output := generateFixtureWith(t, opts, map[string]string{"a.go": splitOutputFixture})
+	dir := t.TempDir()
+	captureOutput(t, func() { writeSources(dir, sources) })
+	data, err := os.ReadFile(filepath.Join(dir, automationFile))
+	if err != nil {
+		t.Fatalf("%v\n%s", err, output)
+	}
+	formatted, err := format.Source(data)
+	if err != nil {
+		t.Fatalf("生成的代码无法解析: %v\n%s", err, data)
+	}
+	if string(formatted) != string(data) {
+		t.Errorf("生成的代码应是gofmt格式\n%s", data)
+	}
+}
+
+func TestOutputPathInDirectory(t *testing.T) {
+	sources, output := generateFixtureWith(t, DefaultOptions(), map[string]string{"a.go": splitOutputFixture})
+	parent := t.TempDir()
+	dir := filepath.Join(parent, "pkg")
+	if err := os.Mkdir(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	captureOutput(t, func() { writeSources(dir, sources) })
+	if _, err := os.Stat(filepath.Join(dir, automationFile)); err != nil {
+		t.Fatalf("映射文件应生成在处理的目录中: %v\n%s", err, output)
+	}
+	entries, _ := os.ReadDir(parent)
+	if len(entries) != 1 {
+		t.Errorf("处理的目录之外不应生成文件: %v", entries)
+	}
+	//再次生成时读取已有文件比较Hash，不需要重新写入
+	output = captureOutput(t, func() { writeSources(dir, sources) })
+	if strings.Contains(output, automationFile) {
+		t.Errorf("映射关系未变化时不应重新生成\n%s", output)
+	}
+}
+
+func TestMixedSeparatorPath(t *testing.T) {
+	for in, want := range map[string]string{
+		"":              "",
+		"./sub\\dir":    filepath.Join("sub", "dir"),
+		"a\\b/./c\\..\\d/": filepath.Join("a", "b", "d"),
+		"/tmp/x\\y":     filepath.Join(string(filepath.Separator)+"tmp", "x", "y"),
+	} {
+		if got := normalizePath(in); got != want {
+			t.Errorf("%q 规范化为 %q，应为 %q", in, got, want)
+		}
+	}
+
+	defer func() {
+		options = DefaultOptions()
+	}()
+	dir := writeFixture(t, map[string]string{"sub/pkg/a.go": splitOutputFixture})
+	resetState()
+	var bWritten bool
+	var err error
+	captureOutput(t, func() { bWritten, err = WorkOn(dir + "/sub\\pkg\\") })
+	if !bWritten || err != nil {
+		t.Fatalf("混用分隔符的路径应正常处理，实际返回 %v, %v", bWritten, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sub", "pkg", automationFile)); err != nil {
+		t.Errorf("映射文件应生成在处理的目录中: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("处理的目录之外不应生成文件: %v", entries)
+	}
+}
+
+func TestWorkOnReturnsResult(t *testing.T) {
+	defer func() {
+		options = DefaultOptions()
+	}()
+	dir := writeFixture(t, map[string]string{"a.go": splitOutputFixture})
+	var bWritten bool
+	var err error
+	for i, want := range []bool{true, false} {
+		resetState()
+		captureOutput(t, func() { bWritten, err = WorkOn(dir) })
+		if bWritten != want || err != nil {
+			t.Errorf("第 %d 次生成应返回 %v, nil，实际返回 %v, %v", i+1, want, bWritten, err)
+		}
+	}
+	resetState()
+	dir = writeFixture(t, mismatchFixture)
+	captureOutput(t, func() { bWritten, err = WorkOn(dir) })
+	if bWritten || err == nil || !strings.Contains(err.Error(), "不一致") {
+		t.Errorf("类型不一致时应返回错误，实际返回 %v, %v", bWritten, err)
+	}
+}
+
+func TestSectionHashes(t *testing.T) {
+	sources, _ := generateFixtureWith(t, DefaultOptions(), map[string]string{"a.go": splitOutputFixture})
+	dir := t.TempDir()
+	captureOutput(t, func() { writeSources(dir, sources) })
+	before, err := os.ReadFile(filepath.Join(dir, automationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(before), "//"+routerHashLabel) || !strings.Contains(string(before), "//"+mappingHashLabel) {
+		t.Fatalf("映射文件应记录方法映射与结构映射的Hash\n%s", before)
+	}
+
+	//只修改结构映射时需要重新生成，方法映射部分保持不变
+	sources, _ = generateFixtureWith(t, DefaultOptions(), map[string]string{"a.go": strings.Replace(splitOutputFixture, "type SB", "type SC struct{}\n\n//#Mapping CmdA\ntype SB", 1)})
+	output := captureOutput(t, func() { writeSources(dir, sources) })
+	if !strings.Contains(output, "中结构映射发生变化") || !strings.Contains(output, automationFile+" 成功") {
+		t.Fatalf("只修改结构映射时应重新生成并报告结构映射变化\n%s", output)
+	}
+	after, err := os.ReadFile(filepath.Join(dir, automationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	routerSection := func(data []byte) string {
+		s := string(data)
+		start := strings.Index(s, "//方法映射")
+		end := strings.Index(s, "//方法映射结束")
+		if start < 0 || end < 0 {
+			t.Fatalf("缺少方法映射部分\n%s", s)
+		}
+		return s[start:end]
+	}
+	if routerSection(before) != routerSection(after) {
+		t.Errorf("方法映射部分应保持不变\n%s\n%s", before, after)
+	}
+	if sectionHash(string(before), routerHashLabel) != sectionHash(string(after), routerHashLabel) {
+		t.Errorf("方法映射的Hash不应变化\n%s", after)
+	}
+	if !strings.Contains(string(after), "SC{}") {
+		t.Errorf("结构映射应包含新增的映射\n%s", after)
+	}
+}
+
+func TestPerFileDuplicateKey(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PerFile = true
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"b.go": `package fixture
+
+//#Router CmdA
+func fb() {}
+`,
+	})
+	if !strings.Contains(output, "常量 CmdA 重复映射到 m") {
+		t.Errorf("缺少重复映射的警告: %s", output)
+	}
+	count := 0
+	for _, source := range sources {
+		count += strings.Count(source, "m[CmdA] =")
+	}
+	if count != 1 {
+		t.Errorf("CmdA 应只映射一次，实际 %d 次", count)
+	}
+}
+
+func TestKeyCountExceedsConstCount(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	Cmd1 Cmd = iota
+	Cmd2
+	Cmd3
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router Cmd1 Cmd2 Cmd3 Cmd4
+func f() {}
+
+//#Router Cmd1
+func g() {}
+`,
+	})
+	if !strings.Contains(output, "注解指定了 4 个常量，但类型 Cmd 只定义了 3 个常量") {
+		t.Errorf("缺少常量数量的提示: %s", output)
+	}
+	if strings.Count(output, "注解指定了") != 1 {
+		t.Errorf("只有常量数量超出的注解才应提示: %s", output)
+	}
+	if !strings.Contains(source, "m[Cmd3] = f") {
+		t.Errorf("有效的常量仍应生成映射\n%s", source)
+	}
+}
+
+//包含类型不一致映射的测试源文件
+var mismatchFixture = map[string]string{
+	"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+//#Router CmdB
+func fb(i int) {}
+
+//#Router CmdC
+func fc() string { return "" }
+`,
+}
+
+func TestFailFast(t *testing.T) {
+	sources, output := generateFixtureWith(t, DefaultOptions(), mismatchFixture)
+	if sources != nil {
+		t.Errorf("类型不一致时应中断处理\n%v", sources)
+	}
+	if strings.Count(output, "Error:") != 1 || !strings.Contains(output, "处理程序中断") {
+		t.Errorf("应只报告第一个类型不一致: %s", output)
+	}
+}
+
+func TestCollectAllMismatches(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, mismatchFixture)
+	if strings.Count(output, "Error:") != 2 {
+		t.Errorf("应报告全部类型不一致: %s", output)
+	}
+	source := sources[automationFile]
+	if !strings.Contains(source, "m[CmdA] = fa") {
+		t.Errorf("有效的映射应被生成\n%s", source)
+	}
+	if strings.Contains(source, "= fb") || strings.Contains(source, "= fc") {
+		t.Errorf("类型不一致的映射不应被生成\n%s", source)
+	}
+}
+
+//名称映射测试源文件
+var nameMapFixture = map[string]string{
+	"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdUserLogin Cmd = iota
+	CmdHTTPStatus
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#NameMap
+var names = make(map[Cmd]string)
+
+//#Router CmdUserLogin CmdHTTPStatus
+func f() {}
+`,
+}
+
+func TestSuggestValueType(t *testing.T) {
+	fixture := `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[%s]%s)
+
+//#Router CmdA
+func handle(id int, name string) error { return nil }
+`
+	_, output := generateFixture(t, map[string]string{"a.go": fmt.Sprintf(fixture, "Cmd", "func()")})
+	i := strings.Index(output, "a.go:13 将 Map m 的值类型改为: ")
+	if i < 0 {
+		t.Fatalf("类型不一致时应给出建议的值类型\n%s", output)
+	}
+	valueType := strings.TrimSpace(strings.SplitN(output[i+len("a.go:13 将 Map m 的值类型改为: "):], "\n", 2)[0])
+	if valueType != "func(int,string)(error)" {
+		t.Errorf("建议的值类型 %q 与函数签名不一致", valueType)
+	}
+	//使用建议的值类型后映射有效
+	source, output := generateFixture(t, map[string]string{"a.go": fmt.Sprintf(fixture, "Cmd", valueType)})
+	if strings.Contains(output, "不一致") || !strings.Contains(source, "m[CmdA] = handle") {
+		t.Errorf("使用建议的值类型后映射应有效\n%s%s", output, source)
+	}
+}
+
+func TestNameMapTransforms(t *testing.T) {
+	cases := []struct {
+		transform NameTransform
+		login     string
+		status    string
+	}{
+		{NameIdentity, `"CmdUserLogin"`, `"CmdHTTPStatus"`},
+		{NameSnake, `"user_login"`, `"http_status"`},
+		{NameKebab, `"user-login"`, `"http-status"`},
+		{NameTrimPrefix, `"UserLogin"`, `"HTTPStatus"`},
+	}
+	for _, c := range cases {
+		opts := DefaultOptions()
+		opts.NameTransform = c.transform
+		opts.NamePrefix = "Cmd"
+		sources, output := generateFixtureWith(t, opts, nameMapFixture)
+		source := sources[automationFile]
+		for _, want := range []string{"names[CmdUserLogin] = " + c.login, "names[CmdHTTPStatus] = " + c.status} {
+			if !strings.Contains(source, want) {
+				t.Errorf("转换方式 %d 生成代码缺少 %q\n%s%s", c.transform, want, source, output)
+			}
+		}
+	}
+}
+
+//使用文件级配置的映射
+var routerConfigFixture = map[string]string{
+	"a.go": `//#RouterConfig out=router_gen.go prefix=Cmd strict=true
+package fixture
+
+type Cmd int
+
+const (
+	CmdUserLogin Cmd = iota
+	CmdHTTPStatus
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#NameMap
+var names = make(map[Cmd]string)
+
+//#Router CmdUserLogin
+func Login() {}
+
+//#Router CmdHTTPStatus
+func status() {}
+
+//#RouterConfig validate=true
+`,
+}
+
+func TestRouterConfig(t *testing.T) {
+	opts := DefaultOptions()
+	opts.NameTransform = NameTrimPrefix
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, routerConfigFixture)
+	source, ok := sources["router_gen.go"]
+	if !ok {
+		t.Fatalf("应使用配置的输出文件名 %v\n%s", sources, output)
+	}
+	if !strings.Contains(source, `names[CmdUserLogin] = "UserLogin"`) {
+		t.Errorf("应使用配置的常量名前缀\n%s", source)
+	}
+	if !strings.Contains(output, "映射的函数 status 未导出") || strings.Contains(source, "= status") {
+		t.Errorf("strict=true 时应要求映射的函数是导出的\n%s%s", output, source)
+	}
+	if !strings.Contains(output, "a.go:23 #RouterConfig 需要位于文件开头的声明之前") || strings.Contains(source, "ValidateRoutes") {
+		t.Errorf("文件中间的配置应被忽略\n%s%s", output, source)
+	}
+	if strings.Contains(output, "注解位置无效") {
+		t.Errorf("文件开头的配置不应报告注解位置无效\n%s", output)
+	}
+
+	//调用接口时指定的选项优先
+	opts.Output = "custom_gen.go"
+	opts.NamePrefix = "CmdUser"
+	opts.RequireExported = true
+	sources, output = generateFixtureWith(t, opts, routerConfigFixture)
+	source, ok = sources["custom_gen.go"]
+	if !ok {
+		t.Fatalf("指定的输出文件名应优先于配置 %v\n%s", sources, output)
+	}
+	if !strings.Contains(source, `names[CmdUserLogin] = "Login"`) {
+		t.Errorf("指定的常量名前缀应优先于配置\n%s", source)
+	}
+}
+
+func TestRouterConfigInvalid(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `//#RouterConfig out=a_gen.go strict=yes unknown=1 bad
+package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func f() {}
+`,
+		"b.go": `//#RouterConfig out=b_gen.go
+package fixture
+`,
+	})
+	for _, want := range []string{
+		"a.go:1 #RouterConfig 配置 bad 格式错误",
+		"a.go:1 #RouterConfig 未知的配置 unknown",
+		"a.go:1 #RouterConfig 配置 strict 无效：yes 不是有效的布尔值",
+		"b.go:1 #RouterConfig 配置 out=b_gen.go 与",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("缺少警告 %q\n%s", want, output)
+		}
+	}
+}
+
+func TestNameMapValueType(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#NameMap
+var names = make(map[Cmd]int)
+
+//#Router CmdA
+func f() {}
+`,
+	})
+	if !strings.Contains(output, "#NameMap 的值类型必须是 string") {
+		t.Errorf("缺少值类型错误的警告: %s", output)
+	}
+}
+
+func TestRouterMapNotMap(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+type Registry[K comparable, V any] struct {
+	m map[K]V
+}
+
+//#RouterMap
+var routes Registry[Cmd, func()]
+
+//#Router CmdA
+func f() {}
+`,
+	})
+	if !strings.Contains(output, "#RouterMap 必须是 map 类型，变量 routes 不是 map 类型") {
+		t.Errorf("缺少非map类型的诊断信息: %s", output)
+	}
+}
+
+func TestBlankMapVariable(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+var _ = make(map[Cmd]func())
+
+var (
+	_ map[Cmd]func()
+	_ []func()
+)
+
+//#RouterMap
+var _ = make(map[Cmd]func())
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func f() {}
+`,
+	})
+	if !strings.Contains(output, "a.go:16 #RouterMap 注释的变量是空白标识符 _") {
+		t.Errorf("注释空白标识符变量时应报告警告\n%s", output)
+	}
+	if !strings.Contains(source, "m[CmdA] = f") || strings.Contains(source, "_[") {
+		t.Errorf("空白标识符变量不应作为Map\n%s%s", output, source)
+	}
+}
+
+func TestFullWidthSpaceKeys(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": "package fixture\n\ntype Cmd int\n\nconst (\n\tCmdA Cmd = iota\n\tCmdB\n\tCmdC\n)\n\n" +
+			"//#RouterMap\nvar m = make(map[Cmd]func())\n\n" +
+			"//#Router\u3000CmdA\u3000CmdB \u00a0CmdC\nfunc f() {}\n",
+	})
+	for _, want := range []string{"m[CmdA] = f", "m[CmdB] = f", "m[CmdC] = f"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestMappingDuplicateKey(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Mapping CmdA
+type SA struct{}
+
+//#Mapping CmdA CmdB
+type SB struct{}
+`,
+	})
+	if !strings.Contains(output, "a.go:16 常量 CmdA 重复映射到 mm，已经在") || !strings.Contains(output, "a.go:13 处映射到 SA") {
+		t.Errorf("结构重复映射同一常量时应报告两处映射的位置\n%s", output)
+	}
+	if !strings.Contains(source, "mm[CmdA] = SA{}") || strings.Contains(source, "mm[CmdA] = SB{}") || !strings.Contains(source, "mm[CmdB] = SB{}") {
+		t.Errorf("重复映射时应保留先出现的映射\n%s", source)
+	}
+}
+
+func TestMappingPtr(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+type Resetter interface {
+	Reset() string
+}
+
+//#MappingPtr CmdA
+type SA struct{}
+
+func (s *SA) Reset() string { return "a" }
+
+//#Mapping CmdB
+type SB struct{}
+
+func main() {
+	_, isPtr := mm[CmdA].(Resetter)
+	_, isValue := mm[CmdB].(SB)
+	fmt.Println(mm[CmdA].(Resetter).Reset(), isPtr, isValue)
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	if !strings.Contains(source, "mm[CmdA] = &SA{}") || !strings.Contains(source, "mm[CmdB] = SB{}") {
+		t.Fatalf("#MappingPtr 应生成结构指针，#Mapping 保持结构值\n%s%s", source, output)
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "a true true" {
+		t.Errorf("结构指针映射运行结果不正确: %s", out)
+	}
+}
+
+func TestMappingReverse(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#MappingReverse
+var reverse = make(map[string]Cmd)
+
+//#Mapping CmdA
+type SSS struct{}
+
+//#Mapping CmdB CmdC
+type TTT struct{}
+`,
+	})
+	for _, want := range []string{`reverse["SSS"] = CmdA`, `reverse["TTT"] = CmdB`} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if strings.Contains(source, "= CmdC") {
+		t.Errorf("同一结构只应反向映射到第一个常量\n%s", source)
+	}
+}
+
+func TestRefuseOverwriteHandWrittenFile(t *testing.T) {
+	dir := t.TempDir()
+	handWritten := "package fixture\n\n//手写的文件\nfunc helper() {}\n"
+	target := outputPath(dir, automationFile)
+	if err := os.WriteFile(target, []byte(handWritten), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var written bool
+	output := captureOutput(t, func() {
+		written = writeSources(dir, map[string]string{automationFile: "package fixture\n"})
+	})
+	if written {
+		t.Errorf("不应写入任何文件")
+	}
+	if !strings.Contains(output, "拒绝覆盖") {
+		t.Errorf("缺少拒绝覆盖的错误信息: %s", output)
+	}
+	data, _ := os.ReadFile(target)
+	if string(data) != handWritten {
+		t.Errorf("手写的文件被覆盖: %s", data)
+	}
+}
+
+func TestOverwriteGeneratedFile(t *testing.T) {
+	dir := t.TempDir()
+	target := outputPath(dir, automationFile)
+	if err := os.WriteFile(target, []byte("package fixture\r\n//"+generatedMarker+"，请不要随意修改!\r\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var written bool
+	captureOutput(t, func() {
+		written = writeSources(dir, map[string]string{automationFile: "package fixture\r\n//" + generatedMarker + "\r\n"})
+	})
+	if !written {
+		t.Errorf("自动生成的文件应被覆盖")
+	}
+}
+
+func TestCompositeLiteralKeys(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type RouteKey struct {
+	Method, Path string
+}
+
+type OtherKey struct {
+	Name string
+}
+
+//#RouterMap
+var routes = make(map[RouteKey]func())
+
+//#Router RouteKey{"GET", "/"} RouteKey{Method: "POST", Path: "/login page"}
+func index() {}
+
+//#Router OtherKey{"x"} RouteKey{"GET",
+func bad() {}
+`,
+	})
+	for _, want := range []string{`routes[RouteKey{"GET", "/"}] = index`, `routes[RouteKey{Method: "POST", Path: "/login page"}] = index`} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if strings.Contains(source, "bad") {
+		t.Errorf("类型不一致或无法解析的复合字面量不应生成映射\n%s", source)
+	}
+	if !strings.Contains(output, `OtherKey{"x"}`) || !strings.Contains(output, `RouteKey{"GET",`) {
+		t.Errorf("缺少无效复合字面量的警告: %s", output)
+	}
+}
+
+func TestRequireExported(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func HandleA() {}
+
+//#Router CmdB
+func handleB() {}
+`,
+	}
+	opts := DefaultOptions()
+	opts.RequireExported = true
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, files)
+	if !strings.Contains(output, "映射的函数 handleB 未导出") {
+		t.Errorf("缺少未导出函数的诊断信息: %s", output)
+	}
+	if strings.Contains(output, "HandleA") {
+		t.Errorf("导出的函数不应报告: %s", output)
+	}
+	source := sources[automationFile]
+	if !strings.Contains(source, "m[CmdA] = HandleA") || strings.Contains(source, "handleB") {
+		t.Errorf("只应生成导出函数的映射\n%s", source)
+	}
+
+	_, output = generateFixture(t, files)
+	if strings.Contains(output, "未导出") {
+		t.Errorf("未启用选项时不应检查函数是否导出: %s", output)
+	}
+}
+
+func TestRepeatedExplicitConstType(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type CmdType int
+
+const (
+	A CmdType = iota
+	B CmdType = iota
+	C CmdType = iota
+)
+
+//#RouterMap
+var m = make(map[CmdType]func())
+
+//#Router A B C
+func f() {}
+`,
+	})
+	for _, tp := range typeList {
+		if tp.typeName != "CmdType" {
+			continue
+		}
+		if got := strings.Join(tp.constValues, ","); got != "A,B,C" {
+			t.Errorf("每个常量应只记录一次，实际为 %s", got)
+		}
+	}
+	if strings.Contains(output, "只定义了") || !strings.Contains(source, "m[C] = f") {
+		t.Errorf("显式类型的常量应正常映射\n%s%s", output, source)
+	}
+}
+
+func TestRouterEach(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+//#RouterEach handle%s
+const (
+	CmdLogin Cmd = iota
+	CmdLogout
+	CmdPing
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+func handleLogin() {}
+
+func handleLogout() {}
+`,
+	})
+	for _, want := range []string{"m[CmdLogin] = handleLogin", "m[CmdLogout] = handleLogout"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if !strings.Contains(output, "常量 CmdPing 对应的函数 handlePing 未定义") {
+		t.Errorf("缺少函数未定义的警告: %s", output)
+	}
+}
+
+func TestRouterEachCustomPrefix(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Op int
+
+//#RouterEach on%sHandler Op_
+const (
+	Op_Login Op = iota
+)
+
+//#RouterMap
+var m = make(map[Op]func())
+
+func onLoginHandler() {}
+`,
+	})
+	if !strings.Contains(source, "m[Op_Login] = onLoginHandler") {
+		t.Errorf("生成代码缺少 m[Op_Login] = onLoginHandler\n%s%s", source, output)
+	}
+}
+
+func TestRouterEachInvalidTemplate(t *testing.T) {
+	for _, tmpl := range []string{"handle%s%d", "handle%%s", "handle%v"} {
+		source, output := generateFixture(t, map[string]string{
+			"a.go": `package fixture
+
+type Cmd int
+
+//#RouterEach ` + tmpl + `
+const (
+	CmdLogin Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+func handleLogin() {}
+`,
+		})
+		if strings.Contains(source, "MISSING") || strings.Contains(source, "m[CmdLogin]") {
+			t.Errorf("模板 %s 不应生成映射\n%s", tmpl, source)
+		}
+		if !strings.Contains(output, "#RouterEach 需要指定只包含一个 %s 的函数名模板") {
+			t.Errorf("模板 %s 应报告格式错误\n%s", tmpl, output)
+		}
+	}
+}
+
+func TestDiagnosticsSorted(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdX
+func fa() {}
+
+//#Router CmdA CmdY CmdZ
+func fb() {}
+`,
+		"b.go": `package fixture
+
+//#Router CmdW
+func fc() {}
+
+//#Mapping CmdA
+func notStruct() {}
+`,
+	})
+	lines := strings.Split(strings.TrimSpace(output), "\r\n")
+	want := []string{
+		"a.go:12 指定的常量 CmdX",
+		"a.go:15 指定的常量 CmdY",
+		"a.go:15 指定的常量 CmdZ",
+		"Note: ",
+		"b.go:3 指定的常量 CmdW",
+		"b.go:6 #Mapping 没有找到有效的结构定义",
+	}
+	if len(lines) != len(want) {
+		t.Fatalf("诊断信息数量应为 %d，实际为 %d\n%s", len(want), len(lines), output)
+	}
+	for i, w := range want {
+		if !strings.Contains(lines[i], w) {
+			t.Errorf("第 %d 条诊断信息应包含 %q，实际为 %q", i+1, w, lines[i])
+		}
+	}
+}
+
+//在临时目录中写入测试源文件，返回目录路径
+func writeFixture(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, src := range files {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestMultipleRoots(t *testing.T) {
+	root1 := writeFixture(t, map[string]string{
+		"types.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	})
+	root2 := writeFixture(t, map[string]string{
+		"handlers.go": `package fixture
+
+//#Router CmdB
+func fb() {}
+`,
+	})
+	resetState()
+	var sources map[string]string
+	output := captureOutput(t, func() {
+		sources, _ = generateSource(root1, root2)
+	})
+	if len(sources) != 1 {
+		t.Fatalf("应只生成一个映射文件，实际为 %d 个\n%s", len(sources), output)
+	}
+	source := sources[automationFile]
+	for _, want := range []string{"m[CmdA] = fa", "m[CmdB] = fb"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestMultipleRootsPackageMismatch(t *testing.T) {
+	root1 := writeFixture(t, map[string]string{
+		"a.go": "package fixture\n",
+	})
+	root2 := writeFixture(t, map[string]string{
+		"b.go": "package other\n\n//#RouterMap\nvar m = make(map[int]func())\n",
+	})
+	resetState()
+	var ok bool
+	output := captureOutput(t, func() {
+		_, ok = generateSource(root1, root2)
+	})
+	if ok || !strings.Contains(output, "包名 other 与 fixture 不一致") {
+		t.Errorf("多个目录的包名不一致时应中断处理: %s", output)
+	}
+}
+
+func TestPackageMismatchPolicy(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"b.go": "package other\n\n//#Router CmdA\nfunc fb() {}\n",
+	}
+	for _, c := range []struct {
+		policy  PackageMismatchPolicy
+		ok      bool
+		message string
+	}{
+		{PackageMismatchDefault, true, ""},
+		{PackageMismatchSkip, true, ""},
+		{PackageMismatchWarn, true, "Warning: "},
+		{PackageMismatchError, false, "Error: "},
+	} {
+		opts := DefaultOptions()
+		opts.PackageMismatchPolicy = c.policy
+		dir := writeFixture(t, files)
+		resetState()
+		options = opts
+		var sources map[string]string
+		var ok bool
+		output := captureOutput(t, func() {
+			sources, ok = generateSource(dir)
+		})
+		options = DefaultOptions()
+		if ok != c.ok {
+			t.Errorf("PackageMismatchPolicy %d 时处理结果应为 %v\n%s", c.policy, c.ok, output)
+		}
+		if c.message == "" && output != "" {
+			t.Errorf("PackageMismatchPolicy %d 时不应报告包名不一致\n%s", c.policy, output)
+		}
+		if c.message != "" && !strings.Contains(output, c.message+filepath.Join(dir, "b.go")) {
+			t.Errorf("PackageMismatchPolicy %d 时应报告 b.go 的包名不一致\n%s", c.policy, output)
+		}
+		if ok && (!strings.Contains(sources[automationFile], "m[CmdA] = fa") || strings.Contains(sources[automationFile], "= fb")) {
+			t.Errorf("PackageMismatchPolicy %d 时应只生成 a.go 的映射\n%s", c.policy, sources[automationFile])
+		}
+	}
+}
+
+func TestAnnotationFiles(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AnnotationFiles = []string{"b.go"}
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Router CmdA
+func fa() {}
+
+//#Mapping CmdA
+type SA struct{}
+`,
+		"b.go": `package fixture
+
+//#Router CmdB
+func fb() {}
+`,
+	})
+	source := sources[automationFile]
+	if !strings.Contains(source, "m[CmdB] = fb") {
+		t.Errorf("指定文件中的注解应生效\n%s%s", source, output)
+	}
+	if strings.Contains(source, "= fa") || strings.Contains(source, "SA{}") {
+		t.Errorf("其他文件中的映射注解不应生效\n%s%s", source, output)
+	}
+}
+
+func TestTargetInGeneratedFile(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+//#RouterEach handle%s Cmd
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+func handleA() {}
+`,
+		"z_gen.go": "package fixture\n//" + generatedMarker + "，请不要随意修改!\n\nfunc handleB() {}\n",
+	})
+	if !strings.Contains(output, "a.go:5 #RouterEach 常量 CmdB 对应的函数 handleB 未定义") {
+		t.Errorf("自动生成的文件不应被解析，其中的映射目标应报告未定义\n%s%s", output, source)
+	}
+	if !strings.Contains(source, "m[CmdA] = handleA") || strings.Contains(source, "handleB") {
+		t.Errorf("只应映射手写文件中的函数\n%s", source)
+	}
+}
+
+func TestSkipGeneratedFile(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		//手动修改过的映射文件，即使去掉了标记也按文件名跳过
+		automationFile: `package fixture
+
+//#Router CmdB
+func fb() {}
+
+func init() {
+	m[CmdA] = fb
+}
+`,
+	})
+	if !strings.Contains(source, "m[CmdA] = fa") || strings.Contains(source, "= fb") {
+		t.Errorf("不应解析上次生成的映射文件\n%s%s", output, source)
+	}
+	if strings.Contains(output, "Warning") {
+		t.Errorf("跳过映射文件时不应报告警告\n%s", output)
+	}
+}
+
+func TestExcludePatterns(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"vendor/x/x.go":      "package x\n",
+		"testdata/t.go":      "package t\n",
+		"internal/y/y.go":    "package y\n",
+		"skip_gen.go":        "package fixture\n\n//#Router CmdB\nfunc fb() {}\n",
+		"sub/nested/skip.go": "package fixture\n\n//#Router CmdB\nfunc fc() {}\n",
+	}
+	opts := DefaultOptions()
+	opts.PackageMismatchPolicy = PackageMismatchError
+	opts.Exclude = append(opts.Exclude, "internal", "*_gen.go", "sub/*")
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	if strings.Contains(output, "不一致") || !strings.Contains(source, "m[CmdA] = fa") {
+		t.Errorf("排除的目录不应被处理\n%s%s", output, source)
+	}
+	if strings.Contains(source, "= fb") || strings.Contains(source, "= fc") {
+		t.Errorf("排除的文件不应被处理\n%s", source)
+	}
+
+	//不排除时 vendor 中的其他包导致包名不一致
+	opts.Exclude = nil
+	_, output = generateFixtureWith(t, opts, files)
+	if !strings.Contains(output, "包名 x 与 fixture 不一致") {
+		t.Errorf("未排除的目录应被处理\n%s", output)
+	}
+}
+
+func TestAnnotationInHeader(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+//#Router CmdA
+
+import (
+	"fmt"
+)
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+func fa() { fmt.Println() }
+
+//#Router CmdB
+func fb() {}
+`,
+	})
+	if !strings.Contains(output, "a.go:3 注解位置无效：#Router 位于import声明之前") {
+		t.Errorf("文件头部的注解应报告位置无效\n%s", output)
+	}
+	if strings.Contains(output, "没有找到有效的") {
+		t.Errorf("文件头部的注解不应对应到其他声明\n%s", output)
+	}
+	if strings.Contains(source, "= fa") || !strings.Contains(source, "m[CmdB] = fb") {
+		t.Errorf("只应生成有效位置注解的映射\n%s", source)
+	}
+}
+
+func TestAnnotationInsideTypeBody(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+type Service interface {
+	//#Router CmdA
+	Handle()
+}
+
+type Holder struct {
+	//#Mapping CmdB
+	Field int
+}
+
+//#Router CmdB
+func fb() {}
+
+func other() {}
+`,
+	})
+	if !strings.Contains(output, "a.go:14 注解位于 interface 类型 Service 的定义内部") {
+		t.Errorf("缺少interface内部注解的诊断信息: %s", output)
+	}
+	if !strings.Contains(output, "a.go:19 注解位于 struct 类型 Holder 的定义内部") {
+		t.Errorf("缺少struct内部注解的诊断信息: %s", output)
+	}
+	if strings.Contains(source, "m[CmdA]") {
+		t.Errorf("类型定义内部的注解不应生成映射\n%s", source)
+	}
+	if !strings.Contains(source, "m[CmdB] = fb") {
+		t.Errorf("生成代码缺少 m[CmdB] = fb\n%s", source)
+	}
+}
+
+//将测试源文件与生成的代码作为独立模块编译运行，返回程序输出，用于验证生成代码的运行结果
+func runFixture(t *testing.T, files map[string]string, sources map[string]string) string {
+	out, err := buildFixture(t, files, sources)
+	if err != nil {
+		t.Fatalf("编译运行失败: %v\n%s", err, out)
+	}
+	return out
+}
+
+//编译运行测试源文件与生成的代码，返回编译器或程序的输出
+func buildFixture(t *testing.T, files map[string]string, sources map[string]string) (string, error) {
+	if testing.Short() {
+		t.Skip("short 模式跳过编译运行测试")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("没有找到 go 命令")
+	}
+	all := map[string]string{"go.mod": "module fixture\n\ngo 1.18\n"}
+	for name, src := range files {
+		all[name] = src
+	}
+	for name, src := range sources {
+		all[name] = src
+	}
+	cmd := exec.Command(goBin, "run", ".")
+	cmd.Dir = writeFixture(t, all)
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+func TestMethodTargets(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+type Controller struct {
+	name string
+}
+
+//#Router CmdA
+func (c *Controller) Handle() string { return "handle" + c.name }
+
+//#Router CmdB
+func (c Controller) Info() string { return "info" + c.name }
+
+func main() {
+	fmt.Println(m[CmdA](), m[CmdB]())
+}
+`,
+	}
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	source := sources[automationFile]
+	for _, want := range []string{"m[CmdA] = (&Controller{}).Handle", "m[CmdB] = Controller{}.Info"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "handle info" {
+		t.Errorf("方法映射运行结果不正确: %s", out)
+	}
+
+	//Map的值类型包含接收者时使用方法表达式
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output = generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+type Controller struct{}
+
+//#RouterMap
+var m = make(map[Cmd]func(*Controller, int) error)
+
+//#Router CmdA
+func (c *Controller) Handle(n int) error { return nil }
+
+//#Router CmdB
+func (c *Controller) Bad() error { return nil }
+`,
+	})
+	source = sources[automationFile]
+	if !strings.Contains(source, "m[CmdA] = (*Controller).Handle") {
+		t.Errorf("生成代码缺少方法表达式\n%s%s", source, output)
+	}
+	if !strings.Contains(output, "定义的函数类型 【func()(error)】") {
+		t.Errorf("方法类型不一致时应报告方法值的类型\n%s", output)
+	}
+}
+
+func TestGenericTargets(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+type Req[T any] struct{ V T }
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+//#RouterMap
+var m = make(map[Cmd]func(Req[int]) string)
+
+//#RouterMap
+var pm = make(map[Cmd]func(Pair[string, int], ...int) map[string]int)
+
+//#Router CmdA
+func Handle[T any](r Req[T]) string { return fmt.Sprint(r.V) }
+
+//#Router pm CmdB
+func Collect[K comparable, V any](p Pair[K, V], extra ...V) map[K]V {
+	return map[K]V{p.Key: p.Value}
+}
+
+//#Router CmdC
+func Bad[T any]() string { return "" }
+
+func main() {
+	fmt.Println(m[CmdA](Req[int]{V: 7}), pm[CmdB](Pair[string, int]{"k", 1})["k"])
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	for _, want := range []string{"m[CmdA] = Handle[int]", "pm[CmdB] = Collect[string, int]"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("泛型函数应按Map的值类型实例化，缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if strings.Contains(source, "Bad") || !strings.Contains(output, "main.go:35 定义的函数类型 【func[T any]()(string)】") {
+		t.Errorf("无法推导类型参数的泛型函数应报告错误\n%s%s", output, source)
+	}
+	if strings.Contains(output, "将 Map m 的值类型改为") {
+		t.Errorf("泛型函数不应建议Map的值类型\n%s", output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "7 1" {
+		t.Errorf("泛型函数映射运行结果不正确: %s", out)
+	}
+}
+
+func TestGenericTypeString(t *testing.T) {
+	cases := map[string]string{
+		"func[T any](r Req[T]) error":                        "func[T any](Req[T])(error)",
+		"func[K comparable, V any](p Pair[K, V]) map[K]V":    "func[K comparable,V any](Pair[K,V])(map[K]V)",
+		"func[T ~int | ~string, U any](a, b T) []Pair[T, U]": "func[T ~int|~string,U any](T,T)([]Pair[T,U])",
+	}
+	for src, want := range cases {
+		f, err := parser.ParseFile(token.NewFileSet(), "a.go", "package p\nfunc f"+strings.TrimPrefix(src, "func")+" { panic(0) }", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getFuncTypeString(f.Decls[0].(*ast.FuncDecl).Type); got != want {
+			t.Errorf("%s 的类型描述字串为 %s，应为 %s", src, got, want)
+		}
+	}
+}
+
+func TestFuncTypeStringSharedNames(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func(int, int, string) (error, error))
+
+//#Router CmdA
+func fa(a, b int, c string) (x, y error) { return nil, nil }
+
+//#Router CmdB
+func fb(a int, c string) (x error) { return nil }
+`,
+	})
+	source := sources[automationFile]
+	if !strings.Contains(source, "m[CmdA] = fa") {
+		t.Errorf("共用类型的参数应分别计数\n%s%s", output, source)
+	}
+	if strings.Contains(source, "= fb") || !strings.Contains(output, "定义的函数类型 【func(int,string)(error)】") {
+		t.Errorf("参数数量不同的函数应报告不一致\n%s%s", output, source)
+	}
+	if !strings.Contains(output, "接受的值类型【func(int,int,string)(error,error)】") {
+		t.Errorf("Map值类型描述字串不正确\n%s", output)
+	}
+}
+
+func TestArrayTypeString(t *testing.T) {
+	cases := map[string]string{
+		"[4]int{}":        "[4]int",
+		"[...]int{1, 2}":  "[...]int",
+		"[N * 2]byte{}":   "[N*2]byte",
+		"[]int{}":         "[]int",
+		"[2][0x10]bool{}": "[2][0x10]bool",
+	}
+	for src, want := range cases {
+		expr, err := parser.ParseExpr(src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := getTypeString(expr.(*ast.CompositeLit).Type); got != want {
+			t.Errorf("%s 的类型描述字串为 %s，应为 %s", src, got, want)
+		}
+	}
+
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func([16]byte) [4]int)
+
+//#Router CmdA
+func fa(id [16]byte) [4]int { return [4]int{} }
+
+//#Router CmdB
+func fb(id []byte) [4]int { return [4]int{} }
+`,
+	})
+	source := sources[automationFile]
+	if !strings.Contains(source, "m[CmdA] = fa") {
+		t.Errorf("固定长度数组的函数类型应一致\n%s%s", output, source)
+	}
+	if strings.Contains(source, "= fb") || !strings.Contains(output, "定义的函数类型 【func([]byte)([4]int)】") {
+		t.Errorf("切片与数组应视为不同的类型\n%s%s", output, source)
+	}
+}
+
+func TestRegisterFunc(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#NameMap
+var names = make(map[Cmd]string)
+
+//#Router CmdA CmdB
+func fa() string { return "a" }
+
+//#Mapping CmdB
+type SB struct{}
+
+func main() {
+	_, ok := mm[CmdB].(SB)
+	fmt.Println(m[CmdB](), ok, names[CmdA])
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.RegisterFunc = "Register"
+	opts.GoVersion = "1.18"
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	for _, want := range []string{
+		"func Register[K comparable, V any](m map[K]V, k K, v V) {",
+		"Register[Cmd, func()(string)](m, CmdA, fa)",
+		"Register[Cmd, interface{}](mm, CmdB, SB{})",
+		`Register[Cmd, string](names, CmdA, "CmdA")`,
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if strings.Contains(source, "m[CmdA] =") {
+		t.Errorf("指定RegisterFunc时不应直接赋值\n%s", source)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "a true CmdA" {
+		t.Errorf("泛型注册函数运行结果不正确: %s", out)
+	}
+}
+
+func TestGoVersion(t *testing.T) {
+	files := map[string]string{"a.go": splitOutputFixture}
+	cases := []struct {
+		version string
+		generic bool
+	}{
+		{"", false},
+		{"1.17", false},
+		{"1.18", true},
+		{"go1.21.3", true},
+		{"latest", false},
+	}
+	for _, c := range cases {
+		opts := DefaultOptions()
+		opts.RegisterFunc = "Register"
+		opts.GoVersion = c.version
+		sources, output := generateFixtureWith(t, opts, files)
+		source := sources[automationFile]
+		bGeneric := strings.Contains(source, "func Register[K comparable, V any]")
+		if bGeneric != c.generic {
+			t.Errorf("GoVersion %q 生成泛型注册函数应为 %v\n%s%s", c.version, c.generic, source, output)
+		}
+		if c.generic {
+			continue
+		}
+		//不支持泛型的版本使用赋值语句，不使用any
+		if !strings.Contains(source, "m[CmdA] = fa") || strings.Contains(source, "any") {
+			t.Errorf("GoVersion %q 应使用赋值语句保存映射\n%s", c.version, source)
+		}
+		if !strings.Contains(output, "选项RegisterFunc生成的泛型注册函数需要Go 1.18以上") {
+			t.Errorf("GoVersion %q 不支持泛型时应报告警告\n%s", c.version, output)
+		}
+	}
+}
+
+func TestCmdNameMap(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdLogin Cmd = iota
+	CmdLogout
+	CmdUserInfo
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#CmdNameMap
+var cmds = make(map[string]func() string)
+
+//#Router CmdLogin
+func login() string { return "in" }
+
+//#Router CmdLogout
+func logout() string { return "out" }
+
+//#Router CmdUserInfo
+func userInfo() string { return "info" }
+
+func main() {
+	fmt.Println(len(cmds), cmds["login"](), cmds["logout"](), cmds["userinfo"]())
+}
+`,
+	}
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	source := sources[automationFile]
+	for _, want := range []string{`cmds["login"] = login`, `cmds["logout"] = logout`, `cmds["userinfo"] = userInfo`} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "3 in out info" {
+		t.Errorf("命令名称映射运行结果不正确: %s", out)
+	}
+}
+
+func TestRouterFallback(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+type Result struct {
+	Code int
+}
+
+//#RouterFallback Result{Code: -1}
+//#RouterMap
+var results = make(map[Cmd]Result)
+
+func main() {
+	results[CmdA] = Result{Code: 1}
+	fmt.Println(resultsLookup(CmdA).Code, resultsLookup(CmdB).Code)
+}
+`,
+	}
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "func resultsLookup(key Cmd) Result {") || !strings.Contains(source, "return Result{Code: -1}") {
+		t.Fatalf("生成代码缺少查找函数\n%s%s", source, output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "1 -1" {
+		t.Errorf("key 不存在时应返回默认值，实际输出: %s", out)
+	}
+}
+
+func TestRouterFallbackInvalidExpr(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+//#RouterMap
+//#RouterFallback Result{
+var results = make(map[Cmd]int)
+`,
+	})
+	if !strings.Contains(output, "#RouterFallback 默认值表达式 Result{ 无法解析") {
+		t.Errorf("缺少表达式无法解析的警告: %s", output)
+	}
+}
+
+func TestGenerateDirectiveMismatch(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package fixture
+
+//go:generate go run github.com/ranqd/nodeRouter/cmd/noterouter -dir . -out router_gen.go
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	}
+	_, output := generateFixture(t, files)
+	if !strings.Contains(output, "a.go:3 go:generate 指令指定的输出文件 router_gen.go 与实际使用的输出文件 NodeRouterAutomation.go 不一致") {
+		t.Errorf("缺少go:generate指令不一致的警告: %s", output)
+	}
+
+	opts := DefaultOptions()
+	opts.Output = "router_gen.go"
+	_, output = generateFixtureWith(t, opts, files)
+	if strings.Contains(output, "go:generate") {
+		t.Errorf("go:generate指令与选项一致时不应警告: %s", output)
+	}
+}
+
+func TestSkipTestFileAnnotations(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"a_test.go": `package fixture
+
+//#Router CmdB
+func fixtureHandler() {}
+`,
+	}
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	if len(sources) != 1 || strings.Contains(sources[automationFile], "fixtureHandler") {
+		t.Errorf("测试文件中的映射不应生成到正式代码中\n%v%s", sources, output)
+	}
+
+	opts := DefaultOptions()
+	opts.SkipTestFiles = false
+	sources, output = generateFixtureWith(t, opts, files)
+	if strings.Contains(sources[automationFile], "fixtureHandler") {
+		t.Errorf("测试文件中的映射不应生成到 %s\n%s", automationFile, sources[automationFile])
+	}
+	if !strings.Contains(sources[automationFile], "m[CmdA] = fa") {
+		t.Errorf("正式代码的映射应生成到 %s\n%s%s", automationFile, sources[automationFile], output)
+	}
+	if !strings.Contains(sources["NodeRouterAutomation_test.go"], "m[CmdB] = fixtureHandler") {
+		t.Errorf("测试文件中的映射应生成到 NodeRouterAutomation_test.go\n%v", sources)
+	}
+}
+
+func TestTagMap(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+type Base struct{}
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#TagMap
+var tags = make(map[Cmd]map[string]string)
+
+//#Mapping CmdA
+type Login struct {
+	*Base ` + "`json:\"base\"`" + `
+	Name  string ` + "`json:\"name\" validate:\"required\"`" + `
+	X, Y  int    ` + "`json:\"-\"`" + `
+	inner int
+}
+
+//#Mapping CmdB
+type Logout struct{}
+`,
+	})
+	for _, want := range []string{
+		`tags[CmdA] = map[string]string{"Base": "json:\"base\"", "Name": "json:\"name\" validate:\"required\"", "X": "json:\"-\"", "Y": "json:\"-\""}`,
+		`tags[CmdB] = map[string]string{}`,
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if strings.Contains(source, "inner") {
+		t.Errorf("没有标签的字段不应生成\n%s", source)
+	}
+}
+
+func TestRoutesSortedByConstValue(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdC Cmd = 30
+	CmdA Cmd = 1 << iota
+	CmdB
+)
+
+const CmdD Cmd = (CmdC - 10)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdC CmdD
+func fc() {}
+
+//#Router CmdB CmdA
+func fa() {}
+`,
+	})
+	//CmdA = 2, CmdB = 4, CmdD = 20, CmdC = 30
+	order := []string{"m[CmdA] = fa", "m[CmdB] = fa", "m[CmdD] = fc", "m[CmdC] = fc"}
+	last := -1
+	for _, want := range order {
+		i := strings.Index(source, want)
+		if i < 0 || i < last {
+			t.Fatalf("映射应按常量值顺序生成 %v\n%s%s", order, source, output)
+		}
+		last = i
+	}
+}
+
+//排序选项测试源文件
+var sortOrderFixture = map[string]string{
+	"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+	CmdD
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdD CmdA
+func fz() {}
+`,
+	"b.go": `package fixture
+
+//#Router CmdC
+func fy() {}
+
+//#Router CmdB
+func fx() {}
+`,
+}
+
+func TestSortOrder(t *testing.T) {
+	for _, c := range []struct {
+		order SortOrder
+		want  []string
+	}{
+		{SortByKey, []string{"m[CmdA] = fz", "m[CmdB] = fx", "m[CmdC] = fy", "m[CmdD] = fz"}},
+		{SortByTarget, []string{"m[CmdB] = fx", "m[CmdC] = fy", "m[CmdA] = fz", "m[CmdD] = fz"}},
+		{SortByPosition, []string{"m[CmdA] = fz", "m[CmdD] = fz", "m[CmdC] = fy", "m[CmdB] = fx"}},
+	} {
+		opts := DefaultOptions()
+		opts.SortOrder = c.order
+		//多次生成的顺序应保持一致
+		for i := 0; i < 3; i++ {
+			sources, output := generateFixtureWith(t, opts, sortOrderFixture)
+			source := sources[automationFile]
+			last := -1
+			for _, want := range c.want {
+				i := strings.Index(source, want)
+				if i < 0 || i < last {
+					t.Fatalf("SortOrder %d 时映射应按 %v 的顺序生成\n%s%s", c.order, c.want, source, output)
+				}
+				last = i
+			}
+		}
+	}
+}
+
+func TestAddMethod(t *testing.T) {
+	for _, c := range []struct {
+		order SortOrder
+		want  []string
+	}{
+		{SortByKey, []string{"m.Add(CmdA, fz)", "m.Add(CmdB, fx)", "m.Add(CmdC, fy)", "m.Add(CmdD, fz)"}},
+		{SortByTarget, []string{"m.Add(CmdB, fx)", "m.Add(CmdC, fy)", "m.Add(CmdA, fz)", "m.Add(CmdD, fz)"}},
+	} {
+		opts := DefaultOptions()
+		opts.AddMethod = "Add"
+		opts.SortOrder = c.order
+		sources, output := generateFixtureWith(t, opts, sortOrderFixture)
+		source := sources[automationFile]
+		if strings.Contains(source, "m[") {
+			t.Errorf("指定AddMethod时不应生成索引赋值\n%s", source)
+		}
+		last := -1
+		for _, want := range c.want {
+			i := strings.Index(source, want)
+			if i < 0 || i < last {
+				t.Fatalf("SortOrder %d 时应按 %v 的顺序调用Add\n%s%s", c.order, c.want, source, output)
+			}
+			last = i
+		}
+	}
+}
+
+func TestRoutesSortedByDeclaration(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+import "unsafe"
+
+type Cmd uintptr
+
+const (
+	CmdB Cmd = 30
+	CmdA Cmd = Cmd(unsafe.Sizeof(0))
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA CmdB
+func f() {}
+`,
+	})
+	//CmdA 的值无法计算时按声明顺序生成
+	if a, b := strings.Index(source, "m[CmdA] = f"), strings.Index(source, "m[CmdB] = f"); a < 0 || b < 0 || b > a {
+		t.Errorf("无法计算常量值时映射应按常量声明顺序生成\n%s%s", source, output)
+	}
+}
+
+func TestCrossPackageOutput(t *testing.T) {
+	opts := DefaultOptions()
+	opts.OutputPackage = "routes"
+	opts.ImportPath = "example.com/app/fixture"
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+//#RouterFallback Fallback
+var Handlers = make(map[Cmd]func(cmd Cmd))
+
+//#MappingMap
+var Messages = make(map[Cmd]interface{})
+
+func Fallback(cmd Cmd) {}
+
+//#Router CmdA
+func HandleA(cmd Cmd) {}
+
+//#Mapping CmdB
+type MsgB struct{}
+`,
+	})
+	source := sources[automationFile]
+	for _, want := range []string{
+		"package routes\r\n",
+		`import "example.com/app/fixture"`,
+		"fixture.Handlers[fixture.CmdA] = fixture.HandleA",
+		"fixture.Messages[fixture.CmdB] = fixture.MsgB{}",
+		"func HandlersLookup(key fixture.Cmd) func(fixture.Cmd) {",
+		"if value, ok := fixture.Handlers[key]; ok {",
+		"return fixture.Fallback",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestCrossPackageShadowedMap(t *testing.T) {
+	opts := DefaultOptions()
+	opts.OutputPackage = "routes"
+	opts.OutputDir = "routes"
+	opts.ImportPath = "example.com/app/fixture"
+	_, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var Handlers = make(map[Cmd]func())
+
+//#Router CmdA
+func HandleA() {}
+`,
+		"routes/local.go": `package routes
+
+var Handlers = map[int]func(){}
+
+func fixture() {}
+
+func Dispatch(cmd int) {
+	Handlers := 1
+	_ = Handlers
+}
+`,
+	})
+	for _, want := range []string{
+		"local.go:3 输出包 routes 中声明的 Handlers 与映射的Map同名",
+		"local.go:5 输出包 routes 中声明的 fixture 与处理的包名相同",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("缺少 %q\n%s", want, output)
+		}
+	}
+	//函数中的局部变量不影响包级引用
+	if strings.Count(output, "Warning:") != 2 {
+		t.Errorf("只应报告包级声明\n%s", output)
+	}
+}
+
+func TestQualifyCompositeKey(t *testing.T) {
+	resetState()
+	defer func() {
+		options = DefaultOptions()
+	}()
+	packageName = "fixture"
+	options.OutputPackage = "routes"
+	structList["Key"] = structType{name: "Key"}
+	constList["CmdA"] = constInfo{}
+	for expr, want := range map[string]string{
+		`Key{CmdA: CmdA, Name: "CmdA"}`: `fixture.Key{CmdA: fixture.CmdA, Name: "CmdA"}`,
+		`map[string]Key{"a": {CmdA}}`:   `map[string]fixture.Key{"a": {fixture.CmdA}}`,
+		`fmt.Sprint(CmdA)`:              `fmt.Sprint(fixture.CmdA)`,
+		`func(CmdA Key)`:                `func(CmdA fixture.Key)`,
+	} {
+		if got := qualify(expr); got != want {
+			t.Errorf("qualify(%q) = %q，应为 %q", expr, got, want)
+		}
+	}
+}
+
+func TestCrossPackageRequiresImportPath(t *testing.T) {
+	opts := DefaultOptions()
+	opts.OutputPackage = "routes"
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const CmdA Cmd = 0
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func f() {}
+`,
+	})
+	if sources != nil || !strings.Contains(output, "ImportPath") {
+		t.Errorf("未指定导入路径时应报告错误\n%s", output)
+	}
+}
+
+func TestUserInitReferencesRouterMap(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+func fb() {}
+
+func init() {
+	m[CmdB] = fb
+}
+`,
+		"b.go": `package fixture
+
+func init() {
+	println(len(fb))
+}
+`,
+		automationFile: "package fixture\r\n//" + generatedMarker + "，请不要随意修改!\r\n\r\nfunc init() {\r\n\tm[CmdA] = fa\r\n}\r\n",
+	})
+	if !strings.Contains(output, "a.go:19 init 函数引用了自动生成代码填充的Map m") {
+		t.Errorf("用户的init函数引用映射Map时应输出警告\n%s", output)
+	}
+	if strings.Count(output, "init 函数引用") != 1 {
+		t.Errorf("只有用户的init函数引用映射Map时才输出警告\n%s", output)
+	}
+}
+
+func TestValidateRoutes(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+	CmdD
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+//#Router CmdC
+func fc() {}
+
+func main() {
+	fmt.Println(ValidateRoutes())
+	m[CmdB] = fa
+	m[CmdD] = fc
+	fmt.Println(ValidateRoutes())
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.ValidateRoutes = true
+	sources, output := generateFixtureWith(t, opts, files)
+	if !strings.Contains(sources[automationFile], "func ValidateRoutes() error {") {
+		t.Fatalf("应生成 ValidateRoutes 函数\n%s%s", sources[automationFile], output)
+	}
+	want := "m 缺少常量的映射: CmdB, CmdD\n<nil>"
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != want {
+		t.Errorf("ValidateRoutes 输出 %q，应为 %q", out, want)
+	}
+}
+
+func TestSourceWithBOM(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": "\xEF\xBB\xBF" + `package fixture
+
+type Cmd int
+
+const CmdA Cmd = 0
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA CmdX
+func fa() {}
+`,
+	})
+	if !strings.Contains(source, "m[CmdA] = fa") {
+		t.Errorf("带BOM的文件中的注解应被处理\n%s%s", source, output)
+	}
+	if !strings.Contains(output, "a.go:10 指定的常量 CmdX 未定义") {
+		t.Errorf("带BOM的文件中诊断位置不正确\n%s", output)
+	}
+}
+
+const mappingPairFixture = `package fixture
+
+type Cmd int
+
+const (
+	CmdLogin Cmd = iota
+	CmdLogout
+)
+
+//#RequestMap
+var requests = make(map[Cmd]interface{})
+
+//#ResponseMap
+var responses = make(map[Cmd]interface{})
+
+//#MappingPair CmdLogin LoginReq LoginResp
+//#MappingPair CmdLogout LogoutReq LogoutResp
+
+type LoginReq struct{}
+
+type LoginResp struct{}
+
+type LogoutReq struct{}
+`
+
+func TestMappingPair(t *testing.T) {
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": mappingPairFixture + "\ntype LogoutResp struct{}\n",
+	})
+	source := sources[automationFile]
+	for _, want := range []string{
+		"requests[CmdLogin] = LoginReq{}",
+		"responses[CmdLogin] = LoginResp{}",
+		"requests[CmdLogout] = LogoutReq{}",
+		"responses[CmdLogout] = LogoutResp{}",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestMappingPairMissingStruct(t *testing.T) {
+	sources, output := generateFixtureWith(t, DefaultOptions(), map[string]string{"a.go": mappingPairFixture})
+	source := sources[automationFile]
+	if !strings.Contains(output, "a.go:17 #MappingPair 映射的结构 LogoutResp 未定义") {
+		t.Errorf("响应结构未定义时应报告错误\n%s", output)
+	}
+	if strings.Contains(source, "CmdLogout") || !strings.Contains(source, "responses[CmdLogin] = LoginResp{}") {
+		t.Errorf("只应忽略结构未定义的映射\n%s", source)
+	}
+}
+
+func TestOrphanedTarget(t *testing.T) {
+	sources, _ := generateFixtureWith(t, DefaultOptions(), map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	})
+	dir := t.TempDir()
+	old := "package fixture\r\n//" + generatedMarker + "，请不要随意修改!\r\n\r\nfunc init() {\r\n\tm[CmdA] = fa\r\n\tm[CmdB] = fb\r\n}\r\n"
+	if err := os.WriteFile(outputPath(dir, automationFile), []byte(old), 0666); err != nil {
+		t.Fatal(err)
+	}
+	output := captureOutput(t, func() { writeSources(dir, sources) })
+	if !strings.Contains(output, automationFile+":6 已删除的路由目标 fb") {
+		t.Errorf("生成文件引用已删除的函数时应报告\n%s", output)
+	}
+	if strings.Contains(output, "路由目标 fa") {
+		t.Errorf("仍然存在的函数不应报告\n%s", output)
+	}
+}
+
+func TestRouterSlice(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#RouterSlice
+var handlers []func() string
+
+//#Router CmdC
+func fc() string { return "c" }
+
+//#Router CmdA CmdB
+func fab() string { return "ab" }
+
+func main() {
+	fmt.Println(len(handlers), handlers[CmdA](), handlers[CmdB](), handlers[CmdC]())
+}
+`,
+	}
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "handlers = []func()(string){CmdA: fab, CmdB: fab, CmdC: fc}") {
+		t.Fatalf("应按常量值生成切片映射\n%s%s", source, output)
+	}
+	if strings.Contains(output, "没有映射") {
+		t.Errorf("连续的常量不应报告空缺\n%s", output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "3 ab ab c" {
+		t.Errorf("切片分派输出 %q", out)
+	}
+}
+
+func TestRouterSliceGuard(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#RouterSlice
+var handlers []func() string
+
+//#Router CmdA
+func fa() string { return "a" }
+
+//#Router CmdB
+func fb() string { return "b" }
+
+func main() {
+	fmt.Println(handlers[CmdA](), handlers[CmdB]())
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	for _, want := range []string{"_ = x[CmdA-0]", "_ = x[CmdB-1]"} {
+		if !strings.Contains(source, want) {
+			t.Fatalf("缺少切片下标检查 %q\n%s%s", want, source, output)
+		}
+	}
+	generated := map[string]string{automationFile: source}
+	if out := runFixture(t, files, generated); strings.TrimSpace(out) != "a b" {
+		t.Errorf("常量未变化时下标检查应通过: %s", out)
+	}
+	//常量增加后没有重新生成，切片下标与常量值不再对应
+	enlarged := map[string]string{"main.go": strings.Replace(files["main.go"], "CmdA Cmd = iota", "CmdNone Cmd = iota\n\tCmdA", 1)}
+	out, err := buildFixture(t, enlarged, generated)
+	if err == nil || !strings.Contains(out, "out of bounds") {
+		t.Errorf("常量值变化后下标检查应编译失败: %v\n%s", err, out)
+	}
+}
+
+func TestRouterSliceGaps(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+	CmdD
+	CmdE
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#RouterSlice
+var handlers []func()
+
+//#Router CmdA CmdD
+func f() {}
+`,
+	})
+	if !strings.Contains(source, "handlers = []func(){CmdA: f, CmdD: f, CmdE: nil}") {
+		t.Errorf("有空缺时仍应生成切片映射，切片长度包含末尾没有映射的常量\n%s%s", source, output)
+	}
+	if !strings.Contains(output, "a.go:17 #RouterSlice handlers 的下标 1, 2, 4 没有映射") {
+		t.Errorf("应报告切片下标空缺\n%s", output)
+	}
+}
+
+const wrappedAnnotationFixture = `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//%[1]s#RouterMap%[2]s
+var m = make(map[Cmd]func())
+
+//%[1]s#Router CmdA CmdB%[2]s
+func f() {}
+`
+
+func TestWrappedAnnotation(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{"a.go": fmt.Sprintf(wrappedAnnotationFixture, "[", "]")})
+	for _, want := range []string{"m[CmdA] = f", "m[CmdB] = f"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("默认应支持 //[#Router] 格式的注解，生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+}
+
+func TestWrappedAnnotationCustom(t *testing.T) {
+	opts := DefaultOptions()
+	opts.AnnotationPrefix = "<<"
+	opts.AnnotationSuffix = ">>"
+	sources, output := generateFixtureWith(t, opts, map[string]string{"a.go": fmt.Sprintf(wrappedAnnotationFixture, "<< ", " >>")})
+	source := sources[automationFile]
+	for _, want := range []string{"m[CmdA] = f", "m[CmdB] = f"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("应支持自定义包裹符号的注解，生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	//使用自定义包裹符号时默认的包裹符号不再有效
+	sources, _ = generateFixtureWith(t, opts, map[string]string{"a.go": fmt.Sprintf(wrappedAnnotationFixture, "[", "]")})
+	if strings.Contains(sources[automationFile], "m[CmdA]") {
+		t.Errorf("不应处理其他包裹符号的注解\n%s", sources[automationFile])
+	}
+}
+
+func TestLazyInit(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA CmdB
+func f() {}
+
+func main() {
+	before := len(m)
+	setupRoutes()
+	delete(m, CmdA)
+	setupRoutes()
+	fmt.Println(before, len(m))
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.LazyInit = true
+	opts.OnceName = "setupOnce"
+	opts.EnsureName = "setupRoutes"
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	if strings.Contains(source, "func init()") || !strings.Contains(source, "var setupOnce sync.Once") {
+		t.Fatalf("LazyInit 模式应使用sync.Once生成映射\n%s%s", source, output)
+	}
+	//首次调用前映射为空，重复调用不会再次生成映射
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "0 1" {
+		t.Errorf("LazyInit 输出 %q，应为 %q", out, "0 1")
+	}
+}
+
+func TestCrossPackageUnexportedType(t *testing.T) {
+	opts := DefaultOptions()
+	opts.OutputPackage = "routes"
+	opts.ImportPath = "example.com/app/fixture"
+	sources, output := generateFixtureWith(t, opts, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+type request struct{}
+
+//#RouterMap
+var Handlers = make(map[Cmd]interface{})
+
+//#Router CmdA
+func HandleA(req *request) {}
+
+//#Router CmdB
+func HandleB() {}
+`,
+	})
+	source := sources[automationFile]
+	if !strings.Contains(output, "a.go:16 映射 Handlers[CmdA] = HandleA 引用了未导出的标识符 request") {
+		t.Errorf("映射函数的参数类型未导出时应报告错误\n%s", output)
+	}
+	if strings.Contains(source, "HandleA") || !strings.Contains(source, "fixture.Handlers[fixture.CmdB] = fixture.HandleB") {
+		t.Errorf("只应忽略引用了未导出标识符的映射\n%s", source)
+	}
+}
+
+func TestKeyValidator(t *testing.T) {
+	KeyValidator = func(typeName, constName string) error {
+		if !strings.HasPrefix(constName, typeName) {
+			return fmt.Errorf("常量名需要以 %s 开头", typeName)
+		}
+		return nil
+	}
+	defer func() {
+		KeyValidator = nil
+	}()
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	LoginB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Router CmdA LoginB
+func f() {}
+
+//#Mapping LoginB
+type S struct{}
+`,
+	})
+	if !strings.Contains(source, "m[CmdA] = f") || strings.Contains(source, "LoginB") {
+		t.Errorf("校验失败的常量不应生成映射\n%s", source)
+	}
+	for _, want := range []string{"a.go:16 常量 LoginB 校验失败：常量名需要以 Cmd 开头", "a.go:19 常量 LoginB 校验失败"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q\n%s", want, output)
+		}
+	}
+}
+
+func TestNoInitBuildTag(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short 模式跳过编译运行测试")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("没有找到 go 命令")
+	}
+	repo, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tags := range [][]string{nil, {"noterouter_noinit"}} {
+		//导入本包的程序，映射注解在运行目录中
+		dir := writeFixture(t, map[string]string{
+			"go.mod": "module fixture\n\ngo 1.18\n\nrequire github.com/ranqd/nodeRouter v0.0.0\n\nreplace github.com/ranqd/nodeRouter => " + filepath.ToSlash(repo) + "\n",
+			"main.go": `package main
+
+import _ "github.com/ranqd/nodeRouter"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+func main() {}
+`,
+		})
+		bin := filepath.Join(t.TempDir(), "fixture")
+		args := []string{"build", "-o", bin}
+		if len(tags) > 0 {
+			args = append(args, "-tags", strings.Join(tags, ","))
+		}
+		build := exec.Command(goBin, append(args, ".")...)
+		build.Dir = dir
+		if out, err := build.CombinedOutput(); err != nil {
+			t.Fatalf("编译导入包的程序失败 %v: %v\n%s", tags, err, out)
+		}
+		run := exec.Command(bin)
+		run.Dir = dir
+		if out, err := run.CombinedOutput(); err != nil {
+			t.Fatalf("运行导入包的程序失败 %v: %v\n%s", tags, err, out)
+		}
+		_, err := os.Stat(filepath.Join(dir, automationFile))
+		//使用 noterouter_noinit 编译时导入包不执行任何操作
+		if len(tags) > 0 && !os.IsNotExist(err) {
+			t.Errorf("编译标签 %v 时导入包不应生成映射文件 %v", tags, err)
+		}
+		if len(tags) == 0 && err != nil {
+			t.Errorf("没有编译标签时导入包应生成映射文件 %v", err)
+		}
+	}
+}
+
+func TestTypeAssertions(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA CmdB
+func good() {}
+
+//#Router CmdC
+func bad(a int) {}
+
+func main() {
+	fmt.Println(len(m))
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.TypeAssertions = true
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	for _, want := range []string{
+		"var _ func() = /*line main.go:17:1*/good\r\n",
+		"var _ func() = /*line main.go:20:1*/bad\r\n",
+		"m[CmdC] = bad",
+	} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	if strings.Count(source, "= /*line") != 2 {
+		t.Errorf("同一函数只应检查一次\n%s", source)
+	}
+	if !strings.Contains(output, "Warning:") || strings.Contains(output, "Error:") {
+		t.Errorf("类型不一致时应只报告警告\n%s", output)
+	}
+	//编译器在映射函数的位置报告错误
+	out, err := buildFixture(t, files, sources)
+	if err == nil {
+		t.Fatalf("类型不一致的映射函数应编译失败\n%s", out)
+	}
+	if !strings.Contains(out, "main.go:20:1: cannot use bad") {
+		t.Errorf("编译错误应指向映射函数 bad 的位置\n%s", out)
+	}
+}
+
+func TestAdapters(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+type Req struct {
+	Name string
+}
+
+type Resp struct {
+	Msg string
+}
+
+type Handler func(interface{}) interface{}
+
+//#RouterMap
+var m = make(map[Cmd]Handler)
+
+//#Router CmdA
+func login(req Req) Resp { return Resp{Msg: "hi " + req.Name} }
+
+//#Router CmdB
+func same(v interface{}) interface{} { return v }
+
+//#Router CmdC
+func bad(a, b int) {}
+
+func main() {
+	fmt.Println(m[CmdA](Req{Name: "x"}).(Resp).Msg, m[CmdB](1), len(m))
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.FailFast = false
+	opts.Adapters = true
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "m[CmdA] = func(p0 interface{}) interface{} { return login(p0.(Req)) }") || !strings.Contains(source, "m[CmdB] = same") {
+		t.Fatalf("签名可以转换时应生成适配函数\n%s%s", source, output)
+	}
+	if strings.Contains(source, "bad") || !strings.Contains(output, "定义的函数类型 【func(int,int)】") {
+		t.Errorf("无法适配的签名应报告类型不一致\n%s%s", source, output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "hi x 1 2" {
+		t.Errorf("适配函数输出 %q", out)
+	}
+}
+
+func TestRouteCompactSyntax(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var handlers = make(map[Cmd]func())
+
+//#MappingMap
+var messages = make(map[Cmd]interface{})
+
+//#Route router:CmdA;handlers:CmdB mapping:CmdC
+func f() {}
+
+//#Route mapping:CmdA messages:CmdB unknown:CmdC CmdC
+type S struct{}
+`,
+	})
+	for _, want := range []string{"handlers[CmdA] = f", "handlers[CmdB] = f", "messages[CmdA] = S{}", "messages[CmdB] = S{}"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("生成代码缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	for _, want := range []string{
+		"a.go:17 #Route mapping:CmdC 映射到 #MappingMap，需要注释结构定义",
+		"a.go:20 #Route 指定的Map unknown 未定义",
+		"a.go:20 #Route 格式错误 CmdC",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("输出缺少 %q\n%s", want, output)
+		}
+	}
+}
+
+func TestRouterMapSelectionStable(t *testing.T) {
+	files := map[string]string{
+		"b.go": `package fixture
+
+//#RouterMap
+var mb = make(map[Cmd]func())
+`,
+		"a.go": `package fixture
+
+type Cmd int
+
+const CmdA Cmd = 0
+
+//#RouterMap
+var ma = make(map[Cmd]func())
+
+//#Router CmdA
+func f() {}
+`,
+	}
+	for i := 0; i < 10; i++ {
+		source, output := generateFixture(t, files)
+		if !strings.Contains(source, "ma[CmdA] = f") {
+			t.Fatalf("应使用文件名顺序中第一个定义的 #RouterMap\n%s%s", source, output)
+		}
+		if !strings.Contains(output, "b.go:3 #RouterMap 重复定义") {
+			t.Fatalf("应报告后定义的 #RouterMap 重复\n%s", output)
+		}
+	}
+}
+
+func TestMultipleRouterMaps(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Op int
+
+const (
+	OpRead Op = iota
+	OpWrite
+)
+
+type Event int
+
+const (
+	EventOpen Event = iota
+	EventClose
+)
+
+//#RouterMap
+var ops = make(map[Op]func() string)
+
+//#RouterMap
+var events = make(map[Event]func(string) string)
+
+//#Router OpRead
+func read() string { return "read" }
+
+//#Router ops OpWrite
+func write() string { return "write" }
+
+//#Router events EventOpen EventClose
+func onEvent(name string) string { return "event " + name }
+
+//#Route events:EventOpen
+func wrongMap() string { return "" }
+
+func main() {
+	fmt.Println(ops[OpRead](), ops[OpWrite](), events[EventClose]("close"), len(events))
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	//按Map分组生成
+	last := -1
+	for _, want := range []string{"ops[OpRead] = read", "ops[OpWrite] = write", "events[EventOpen] = onEvent", "events[EventClose] = onEvent"} {
+		i := strings.Index(source, want)
+		if i < 0 || i < last {
+			t.Errorf("生成代码缺少 %q 或顺序不正确\n%s%s", want, source, output)
+		}
+		last = i
+	}
+	//映射到指定Map时按该Map检查值类型
+	if strings.Contains(source, "wrongMap") || !strings.Contains(output, "main.go:35 定义的函数类型 【func()(string)】") {
+		t.Errorf("函数类型应与指定的Map比较\n%s%s", source, output)
+	}
+	if strings.Contains(output, "#RouterMap 重复定义") {
+		t.Errorf("key类型不同的#RouterMap不应提示重复定义\n%s", output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "read write event close 2" {
+		t.Errorf("多个#RouterMap运行结果不正确: %s", out)
+	}
+}
+
+func TestRouterMapsByKeyType(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Op int
+
+const (
+	OpRead Op = iota
+	OpWrite
+)
+
+type Event string
+
+const (
+	EventOpen  Event = "open"
+	EventClose Event = "close"
+)
+
+type Code uint8
+
+const (
+	CodeOK Code = iota
+	CodeFail
+)
+
+//#RouterMap
+var ops = make(map[Op]func() string)
+
+//#RouterMap
+var events = make(map[Event]func() string)
+
+//#RouterMap
+var codes = make(map[Code]func() string)
+
+//#Router OpRead OpWrite
+func op() string { return "op" }
+
+//#Router EventClose EventOpen
+func event() string { return "event" }
+
+//#Router CodeFail
+func fail() string { return "fail" }
+
+//#Router CodeOK
+func ok() string { return "ok" }
+
+//#Router Missing EventOpen
+func mixed() string { return "" }
+
+func main() {
+	fmt.Println(ops[OpWrite](), events[EventOpen](), codes[CodeOK](), codes[CodeFail](), len(ops), len(events), len(codes))
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.FailFast = false
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	for _, want := range []string{"ops[OpRead] = op", "ops[OpWrite] = op", "events[EventClose] = event", "events[EventOpen] = event", "codes[CodeOK] = ok", "codes[CodeFail] = fail"} {
+		if !strings.Contains(source, want) {
+			t.Errorf("应按常量类型映射到对应的Map，缺少 %q\n%s%s", want, source, output)
+		}
+	}
+	//常量类型不一致时映射到第一个定义的Map，按该Map的key类型检查
+	if strings.Contains(source, "mixed") || !strings.Contains(output, "main.go:47 指定的常量 EventOpen 未定义或者与映射Map的key类型 Op 不一致") {
+		t.Errorf("常量类型不一致时应报告警告\n%s%s", output, source)
+	}
+	if strings.Contains(output, "#RouterMap 重复定义") {
+		t.Errorf("key类型不同的#RouterMap不应提示重复定义\n%s", output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "op event ok fail 2 2 2" {
+		t.Errorf("按key类型选择#RouterMap运行结果不正确: %s", out)
+	}
+}
+
+func TestMapInitializedTwice(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"b.go": `package fixture
+
+func Reset() {
+	m = map[Cmd]func(){}
+}
+
+func Local() {
+	m := make(map[Cmd]func())
+	m = make(map[Cmd]func())
+	_ = m
+}
+`,
+	})
+	if !strings.Contains(output, "b.go:4 Map m 已经在") {
+		t.Errorf("Map在多处初始化时应报告警告\n%s", output)
+	}
+	//局部变量的赋值不是Map的重新初始化
+	if strings.Count(output, "已经在") != 1 {
+		t.Errorf("只应报告包级变量的重新初始化\n%s", output)
+	}
+}
+
+func TestPackageNameFromSourceFile(t *testing.T) {
+	stale := "package old\r\n//" + generatedMarker + "，请不要随意修改!\r\n\r\nfunc init() {\r\n}\r\n"
+	source, output := generateFixture(t, map[string]string{
+		//自动生成的文件按文件名排在源文件之前
+		automationFile: stale,
+		"routes.go": `package fixture
+
+type Cmd int
+
+const CmdA Cmd = 0
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func f() {}
+`,
+	})
+	if !strings.HasPrefix(source, "package fixture\r\n") || !strings.Contains(source, "m[CmdA] = f") {
+		t.Errorf("包名应从源文件获取\n%s%s", source, output)
+	}
+	if _, err := parser.ParseFile(token.NewFileSet(), automationFile, source, 0); err != nil {
+		t.Errorf("生成的文件无法解析: %v\n%s", err, source)
+	}
+
+	//只有自动生成的文件时不生成
+	sources, _ := generateFixtureWith(t, DefaultOptions(), map[string]string{automationFile: stale})
+	if sources != nil {
+		t.Errorf("没有源文件时不应生成映射文件\n%v", sources)
+	}
+}
+
+func TestNamedParams(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+import "context"
+
+type Cmd int
+
+const CmdA Cmd = 0
+
+//#RouterMap
+var m = make(map[Cmd]interface{})
+
+//#Router CmdA
+func handle(ctx context.Context, a, b int, _ string) (resp []byte, err error) { return }
+`,
+	})
+	if !strings.Contains(source, "m[CmdA] = handle") {
+		t.Fatalf("生成代码缺少映射\n%s%s", source, output)
+	}
+	fn := funcList["handle"]
+	want := []paramInfo{{"ctx", "context.Context"}, {"a", "int"}, {"b", "int"}, {"_", "string"}}
+	if fmt.Sprint(fn.params) != fmt.Sprint(want) {
+		t.Errorf("参数为 %v，应为 %v", fn.params, want)
+	}
+	wantResults := []paramInfo{{"resp", "[]byte"}, {"err", "error"}}
+	if fmt.Sprint(fn.results) != fmt.Sprint(wantResults) {
+		t.Errorf("返回值为 %v，应为 %v", fn.results, wantResults)
+	}
+	//类型比较字串不包含参数名
+	if strings.Contains(fn.typeString, "ctx") {
+		t.Errorf("函数类型描述字串不应包含参数名 %s", fn.typeString)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+//#Router CmdMissing
+func fb() {}
+`,
+	})
+	resetState()
+	opts := DefaultOptions()
+	opts.PrintDiagnostics = false
+	defer func() {
+		options = DefaultOptions()
+	}()
+	var err error
+	output := captureOutput(t, func() {
+		_, err = WorkOnWith(dir, opts)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//不输出诊断信息与生成映射文件等处理状态
+	if output != "" {
+		t.Errorf("PrintDiagnostics为false时不应输出诊断信息与处理状态\n%s", output)
+	}
+	diags := Diagnostics()
+	if len(diags) != 1 {
+		t.Fatalf("应报告一条诊断信息 %v", diags)
+	}
+	d := diags[0]
+	if filepath.Base(d.File) != "a.go" || d.Line != 15 || d.Severity != "Warning" || !strings.Contains(d.Message, "CmdMissing") {
+		t.Errorf("诊断信息内容错误 %+v", d)
+	}
+	if !strings.HasPrefix(d.String(), "Warning: "+d.File+":15 ") {
+		t.Errorf("诊断信息格式错误 %s", d)
+	}
+	//再次处理时清空上次的诊断信息
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(`package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	captureOutput(t, func() {
+		_, err = WorkOnWith(dir, opts)
+	})
+	if err != nil || len(Diagnostics()) != 0 {
+		t.Errorf("再次处理时应清空诊断信息 %v %v", err, Diagnostics())
+	}
+}
+
+func TestPriority(t *testing.T) {
+	files := map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+	CmdD
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+//#Priority 2
+//#Router CmdB
+func fb() {}
+
+//#Router CmdC
+//#Priority -1
+func fc() {}
+
+//#Priority x
+//#Router CmdD
+func fd() {}
+`,
+	}
+	opts := DefaultOptions()
+	opts.SortOrder = SortByPriority
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	//优先级从小到大，相同时按常量值排列
+	order := []string{"m[CmdC] = fc", "m[CmdA] = fa", "m[CmdD] = fd", "m[CmdB] = fb"}
+	last := -1
+	for _, line := range order {
+		index := strings.Index(source, line)
+		if index <= last {
+			t.Fatalf("映射应按优先级排列 %v\n%s", order, source)
+		}
+		last = index
+	}
+	if !strings.Contains(output, "a.go:26 #Priority 优先级 x 不是有效的整数") {
+		t.Errorf("无效的优先级应报告警告\n%s", output)
+	}
+	//未使用SortByPriority时报告注解不生效
+	_, output = generateFixtureWith(t, DefaultOptions(), files)
+	if !strings.Contains(output, "a.go:18 #Priority 只在选项SortOrder为SortByPriority时生效") {
+		t.Errorf("未按优先级排列时应报告警告\n%s", output)
+	}
+}
+
+func TestRepeatedWorkOn(t *testing.T) {
+	first := writeFixture(t, map[string]string{
+		"a.go": `package first
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	})
+	second := writeFixture(t, map[string]string{
+		"b.go": `package second
+
+type Op int
+
+const (
+	OpB Op = iota
+)
+
+//#RouterMap
+var ops = make(map[Op]func())
+
+//#Router OpB
+func fb() {}
+`,
+	})
+	for _, dir := range []string{first, second} {
+		var err error
+		output := captureOutput(t, func() {
+			_, err = WorkOn(dir)
+		})
+		if err != nil {
+			t.Fatalf("%s 处理失败 %v\n%s", dir, err, output)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(second, automationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := string(data)
+	//第二次处理不包含第一次处理的包与映射
+	if !strings.Contains(source, "package second") || !strings.Contains(source, "ops[OpB] = fb") || strings.Contains(source, "CmdA") {
+		t.Errorf("连续处理多个目录时状态互相影响\n%s", source)
+	}
+}
+
+func TestEmptyAnnotationKeys(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Router CmdA
+func fa() {}
+
+//#Router
+func fb() {}
+
+//[#Mapping ]
+type SSS struct{}
+`,
+	})
+	for _, line := range []string{"a.go:18 #Router 注解未指定任何常量", "a.go:21 #Mapping 注解未指定任何常量"} {
+		if !strings.Contains(output, line) {
+			t.Errorf("未指定常量的注解应报告警告 %s\n%s", line, output)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	dir := writeFixture(t, map[string]string{"a.go": splitOutputFixture})
+	var source string
+	var regenerated bool
+	var err error
+	captureOutput(t, func() {
+		source, regenerated, err = Generate(dir)
+	})
+	if err != nil || !regenerated || !strings.Contains(source, "m[CmdA] = fa") {
+		t.Fatalf("Generate 生成的代码错误 %v %v\n%s", regenerated, err, source)
+	}
+	//不写入文件
+	if _, err := os.Stat(filepath.Join(dir, automationFile)); !os.IsNotExist(err) {
+		t.Fatalf("Generate 不应写入映射文件 %v", err)
+	}
+	captureOutput(t, func() {
+		_, err = WorkOn(dir)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, automationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != source {
+		t.Errorf("Generate 生成的代码与写入的映射文件不一致\n%s\n%s", source, data)
+	}
+	//映射关系未变化
+	captureOutput(t, func() {
+		source, regenerated, err = Generate(dir)
+	})
+	if err != nil || regenerated || string(data) != source {
+		t.Errorf("映射关系未变化时regenerated应为false %v %v", regenerated, err)
+	}
+}
+
+func TestDiagnosticsFile(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+
+//#Router CmdMissing
+func fb() {}
+`,
+	})
+	opts := DefaultOptions()
+	opts.PrintDiagnostics = false
+	opts.DiagnosticsFile = filepath.Join(t.TempDir(), "diagnostics.json")
+	defer func() {
+		options = DefaultOptions()
+	}()
+	captureOutput(t, func() {
+		WorkOnWith(dir, opts)
+	})
+	data, err := os.ReadFile(opts.DiagnosticsFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var diags []Diagnostic
+	if err := json.Unmarshal(data, &diags); err != nil {
+		t.Fatalf("诊断信息文件不是有效的JSON %v\n%s", err, data)
+	}
+	if len(diags) != 1 || diags[0].Line != 15 || diags[0].Severity != "Warning" || !strings.Contains(diags[0].Message, "CmdMissing") {
+		t.Errorf("诊断信息文件内容错误\n%s", data)
+	}
+	if !strings.Contains(string(data), `"severity": "Warning"`) {
+		t.Errorf("诊断信息文件应使用小写的字段名\n%s", data)
+	}
+}
+
+func TestQualifiedKeys(t *testing.T) {
+	files := map[string]string{
+		"pb/op.go": `package pb
+
+type Op int
+
+const (
+	OpLogin Op = iota + 1
+	OpLogout
+)
+`,
+		"main.go": `package main
+
+import (
+	"fmt"
+
+	pb "fixture/pb"
+)
+
+//#RouterMap
+var m = make(map[pb.Op]func() string)
+
+//#Router pb.OpLogin
+func login() string { return "in" }
+
+//#Router pb.OpLogout
+func logout() string { return "out" }
+
+//#Router other.OpLogin
+func other() string { return "other" }
+
+func main() {
+	fmt.Println(m[pb.OpLogin](), m[pb.OpLogout]())
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	for _, line := range []string{"m[pb.OpLogin] = login", "m[pb.OpLogout] = logout", `"fixture/pb"`} {
+		if !strings.Contains(source, line) {
+			t.Errorf("生成的代码应包含 %s\n%s", line, source)
+		}
+	}
+	//包名与Map的key类型不一致
+	if !strings.Contains(output, "main.go:18 指定的常量 other.OpLogin 未定义或者与映射Map的key类型 pb.Op 不一致") {
+		t.Errorf("包名不一致的常量应报告警告\n%s", output)
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "in out" {
+		t.Errorf("映射结果错误 %s", out)
+	}
+}
+
+func TestRouteCoverage(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+	CmdD
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA CmdB
+func fa() {}
+
+//#Router CmdD
+func fd() {}
+
+func main() {
+	fmt.Println(RouteCoverage.Total, RouteCoverage.Mapped)
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.RouteCoverage = true
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "var RouteCoverage = struct{ Total, Mapped int }{4, 3}") {
+		t.Fatalf("映射覆盖率错误\n%s%s", source, output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "4 3" {
+		t.Errorf("运行时的映射覆盖率错误 %s", out)
+	}
+}
+
+func TestLiteralKeys(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Path string
+
+const PathIndex Path = "/"
+
+//#RouterMap
+var m = make(map[Path]func() string)
+
+//#RouterMap
+var codes = make(map[uint16]func() string)
+
+//#Router PathIndex
+func index() string { return "index" }
+
+//#Router "health" "ping"
+func health() string { return "ok" }
+
+//#Router codes 404
+func notFound() string { return "404" }
+
+//#Router codes "500"
+func bad() string { return "bad" }
+
+func main() {
+	fmt.Println(m["/"](), m["health"](), m["ping"](), codes[404]())
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	for _, line := range []string{`m["health"] = health`, `m["ping"] = health`, "codes[404] = notFound"} {
+		if !strings.Contains(source, line) {
+			t.Errorf("生成的代码应包含 %s\n%s%s", line, source, output)
+		}
+	}
+	//字面量类型与key类型不兼容
+	if !strings.Contains(output, `main.go:24 指定的常量 "500" 未定义或者与映射Map的key类型 uint16 不一致`) {
+		t.Errorf("类型不兼容的字面量应报告警告\n%s", output)
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "index ok ok 404" {
+		t.Errorf("映射结果错误 %s", out)
+	}
+}
+
+func TestPackageNameFromSource(t *testing.T) {
+	files := map[string]string{
+		"api/api.go": `package api
+
+type Req struct{}
+`,
+		"a_test.go": `package handlers_test
+`,
+		"main.go": `package handlers
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	}
+	for _, skipTests := range []bool{true, false} {
+		opts := DefaultOptions()
+		opts.SkipTestFiles = skipTests
+		sources, output := generateFixtureWith(t, opts, files)
+		source := sources[automationFile]
+		//包名与目录名不同，先解析的子目录与测试文件不影响包名
+		if !strings.HasPrefix(source, "package handlers\r\n") || !strings.Contains(source, "m[CmdA] = fa") {
+			t.Errorf("SkipTestFiles %v 生成的包名错误\n%s%s", skipTests, source, output)
+		}
+	}
+}
+
+func TestSwitchDispatch(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#RouterFallback unknown
+//#RouterMap
+var ops = make(map[string]func() string)
+
+//#Router CmdA CmdB
+func fa() string { return "a" }
+
+//#Router ops "ping"
+func ping() string { return "pong" }
+
+func unknown() string { return "?" }
+
+func main() {
+	fmt.Println(len(m), mDispatch(CmdA)(), mDispatch(CmdB)(), mDispatch(CmdC) == nil, opsDispatch("ping")(), opsDispatch("x")())
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.Mode = SwitchDispatch
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "func mDispatch(key Cmd) ") || strings.Contains(source, "m[CmdA] = fa") {
+		t.Fatalf("SwitchDispatch 模式应生成分派函数代替Map赋值\n%s%s", source, output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "0 a a true pong ?" {
+		t.Errorf("分派结果错误 %s", out)
+	}
+}
+
+func TestImportBlock(t *testing.T) {
+	files := map[string]string{
+		"pb/status.go": `package pb
+
+type Status int
+`,
+		"main.go": `package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"fixture/pb"
+)
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterFallback unknown
+//#RouterMap
+var m = make(map[Cmd]func(context.Context) pb.Status)
+
+//#Router CmdA
+func fa(ctx context.Context) pb.Status { return 1 }
+
+func unknown(ctx context.Context) pb.Status { return 0 }
+
+func main() {
+	fmt.Println(strings.TrimSpace(" ok "), mLookup(CmdA)(context.Background()), mLookup(CmdB)(context.Background()), ValidateRoutes() != nil)
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.ValidateRoutes = true
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	//只包含生成代码引用的包，按导入路径排序
+	block := "import (\r\n\t\"context\"\r\n\t\"errors\"\r\n\t\"fixture/pb\"\r\n)"
+	if !strings.Contains(source, block) {
+		t.Fatalf("import 声明错误\n%s%s", source, output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "ok 1 0 true" {
+		t.Errorf("运行结果错误 %s", out)
+	}
+}
+
+func TestRouterReverse(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+type Controller struct{}
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#RouterReverse
+var names = make(map[string]Cmd)
+
+//#Router CmdA CmdB
+func fa() {}
+
+//#Router CmdC
+func (c *Controller) Handle() {}
+
+func main() {
+	fmt.Println(len(names), names["fa"], names["(*Controller).Handle"])
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	for _, line := range []string{`names["fa"] = CmdA`, `names["(*Controller).Handle"] = CmdC`} {
+		if !strings.Contains(source, line) {
+			t.Errorf("生成的代码应包含 %s\n%s%s", line, source, output)
+		}
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "2 0 2" {
+		t.Errorf("反向映射结果错误 %s", out)
+	}
+}
+
+func TestFoundDeclDiagnostics(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Router CmdA
+type Login struct{}
+
+//#Mapping CmdB
+func logout() {}
+
+//#RouterMap
+var count int
+`,
+	})
+	for _, line := range []string{
+		"a.go:16 #Router 没有找到有效的函数定义，注解之后是结构 Login",
+		"a.go:19 #Mapping 没有找到有效的结构定义，注解之后是函数 logout",
+		"a.go:22 #RouterMap 必须是 map 类型，变量 count 不是 map 类型",
+	} {
+		if !strings.Contains(output, line) {
+			t.Errorf("应报告注解之后的声明 %s\n%s", line, output)
+		}
+	}
+}
+
+//类型描述字串测试使用的源文件，包含多种类型表达式
+const typeStringFixture = `package fixture
+
+import (
+	ctx "context"
+	"io"
+)
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+type Req[T any] struct{ v T }
+
+//#RouterMap
+var m = make(map[Cmd]func(ctx.Context, *Req[int], [4]byte) (map[string][]io.Reader, error))
+
+//#Router CmdA
+func fa(c ctx.Context, r *Req[int], b [4]byte) (map[string][]io.Reader, error) { return nil, nil }
+
+//#Router CmdB
+func fb(c ctx.Context, r *Req[int], b [4]byte) (map[string][]io.Reader, error) { return nil, nil }
+
+//#Router CmdC
+func fc(c ctx.Context, r *Req[string], b [4]byte) (map[string][]io.Reader, error) { return nil, nil }
+`
+
+func TestTypeStringCache(t *testing.T) {
+	dir := writeFixture(t, map[string]string{"a.go": typeStringFixture})
+	generate := func() (string, string) {
+		resetState()
+		options.FailFast = false
+		defer func() {
+			options = DefaultOptions()
+		}()
+		var sources map[string]string
+		output := captureOutput(t, func() {
+			sources, _ = generateSource(dir)
+		})
+		return sources[automationFile], output
+	}
+	cached, cachedOutput := generate()
+	typeStringCacheEnabled = false
+	defer func() {
+		typeStringCacheEnabled = true
+	}()
+	uncached, uncachedOutput := generate()
+	if !strings.Contains(cached, "m[CmdB] = fb") || cached != uncached || cachedOutput != uncachedOutput {
+		t.Errorf("缓存类型描述字串后生成的结果不一致\n%s%s\n%s%s", cached, cachedOutput, uncached, uncachedOutput)
+	}
+	if !strings.Contains(cachedOutput, "a.go:28") {
+		t.Errorf("类型不一致的函数应报告错误\n%s", cachedOutput)
+	}
+}
+
+func BenchmarkTypeStringCache(b *testing.B) {
+	var src strings.Builder
+	src.WriteString("package fixture\n\nimport \"context\"\n\ntype Cmd int\n\nconst (\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&src, "\tCmd%d Cmd = %d\n", i, i)
+	}
+	src.WriteString(")\n\n//#RouterMap\nvar m = make(map[Cmd]func(context.Context, map[string][]*int) (chan<- struct{}, error))\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&src, "\n//#Router Cmd%d\nfunc f%d(c context.Context, p map[string][]*int) (chan<- struct{}, error) { return nil, nil }\n", i, i)
+	}
+	dir := b.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(src.String()), 0666); err != nil {
+		b.Fatal(err)
+	}
+	for _, enabled := range []bool{true, false} {
+		b.Run(fmt.Sprintf("cache=%v", enabled), func(b *testing.B) {
+			typeStringCacheEnabled = enabled
+			defer func() {
+				typeStringCacheEnabled = true
+			}()
+			stdout := os.Stdout
+			os.Stdout, _ = os.Open(os.DevNull)
+			defer func() {
+				os.Stdout = stdout
+			}()
+			for i := 0; i < b.N; i++ {
+				resetState()
+				generateSource(dir)
+			}
+		})
+	}
+}
+
+func TestAnnotationWhitespace(t *testing.T) {
+	for _, note := range []string{"//#RouterMap ", "// #RouterMap", "//\t#RouterMap\t", "//  #RouterMap  "} {
+		source, output := generateFixture(t, map[string]string{
+			"a.go": "package fixture\n\ntype Cmd int\n\nconst (\n\tCmdA Cmd = iota\n)\n\n" + note + "\nvar m = make(map[Cmd]func())\n\n" +
+				strings.Replace(note, "RouterMap", "MappingMap", 1) + "\nvar mm = make(map[Cmd]interface{})\n\n" +
+				"// #Router CmdA \nfunc fa() {}\n\n//#Mapping CmdA\t\ntype SSS struct{}\n",
+		})
+		if !strings.Contains(source, "m[CmdA] = fa") || !strings.Contains(source, "mm[CmdA] = SSS{}") {
+			t.Errorf("注解 %q 包含空白时应能识别\n%s%s", note, source, output)
+		}
+	}
+}
+
+func TestExternalSetter(t *testing.T) {
+	files := map[string]string{
+		"framework/handler.go": `package framework
+
+var Handlers = map[int]func() string{}
+
+func SetHandler(key int, h func() string) { Handlers[key] = h }
+`,
+		"main.go": `package main
+
+import "fmt"
+
+//#RouterMap external:fixture/framework.SetHandler
+//#RouterMap external:framework
+
+//#Router 1 2
+func fa() string { return "a" }
+
+func main() {
+	fmt.Println(len(framework.Handlers), framework.Handlers[2]())
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	for _, line := range []string{`import "fixture/framework"`, "framework.SetHandler(1, fa)", "framework.SetHandler(2, fa)"} {
+		if !strings.Contains(source, line) {
+			t.Errorf("生成的代码应包含 %s\n%s%s", line, source, output)
+		}
+	}
+	if !strings.Contains(output, "main.go:6 #RouterMap 设置函数 framework 格式错误") || strings.Contains(output, "external:framework 未定义") {
+		t.Errorf("格式错误的设置函数应报告警告\n%s", output)
+	}
+	//使用生成的代码时main.go需要导入framework包
+	files["main.go"] = strings.Replace(files["main.go"], `import "fmt"`, "import (\n\t\"fmt\"\n\n\t\"fixture/framework\"\n)", 1)
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "2 a" {
+		t.Errorf("设置函数映射结果错误 %s", out)
+	}
+}
+
+func TestDirectiveWordBoundary(t *testing.T) {
+	source, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#RouterMapSomething CmdB
+//#Router CmdA
+func fa() {}
+
+//#MappingBar CmdB
+//#Mapping CmdA
+type SSS struct{}
+
+//#RouterMapOther
+func fb() {}
+`,
+	})
+	if !strings.Contains(source, "m[CmdA] = fa") || !strings.Contains(source, "mm[CmdA] = SSS{}") {
+		t.Errorf("注解应正常识别\n%s%s", source, output)
+	}
+	//不是注解的注释不产生映射与警告
+	if strings.Contains(source, "CmdB") || strings.Contains(output, "Warning") {
+		t.Errorf("注解名之后紧接其他字符时不应作为注解\n%s%s", source, output)
+	}
+}
+
+func TestRemoveStaleSources(t *testing.T) {
+	stale := "package sub\n\n//" + generatedMarker + "，请不要随意修改!\n\nfunc init() {\n\tm[CmdA] = fa\n}\n"
+	root := writeFixture(t, map[string]string{
+		"a.go": `package root
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		//注解已被移除的子包
+		"sub/b.go": `package sub
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+var m = make(map[Cmd]func())
+
+func fa() {}
+`,
+		"sub/" + automationFile: stale,
+		"sub/handwritten.go":    "package sub\n\nvar keep = 1\n",
+	})
+	var bWritten bool
+	var err error
+	output := captureOutput(t, func() {
+		bWritten, err = WorkOnTree(root, DefaultOptions())
+	})
+	if err != nil || !bWritten {
+		t.Fatalf("处理目录树失败 %v %v\n%s", bWritten, err, output)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", automationFile)); !os.IsNotExist(err) {
+		t.Fatalf("没有删除子包中遗留的映射文件 %v\n%s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(root, "sub", "handwritten.go")); err != nil {
+		t.Fatalf("删除了非自动生成的文件 %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, automationFile)); err != nil {
+		t.Fatalf("没有生成根目录的映射文件 %v\n%s", err, output)
+	}
+	if !strings.Contains(output, "删除映射文件 "+automationFile) {
+		t.Fatalf("没有输出删除映射文件的提示\n%s", output)
+	}
+
+	//单独处理注解已被移除的目录时同样删除遗留的映射文件
+	dir := writeFixture(t, map[string]string{
+		"b.go":         "package sub\n\nfunc fa() {}\n",
+		automationFile: stale,
+	})
+	output = captureOutput(t, func() {
+		bWritten, err = WorkOn(dir)
+	})
+	if err != nil || !bWritten {
+		t.Fatalf("处理失败 %v %v\n%s", bWritten, err, output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, automationFile)); !os.IsNotExist(err) {
+		t.Fatalf("没有删除遗留的映射文件 %v", err)
+	}
+}
+
+func TestAmbiguousTargets(t *testing.T) {
+	_, output := generateFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdC
+func fc() {}
+`,
+		"f_linux.go": `//go:build linux
+
+package fixture
+
+//#Router CmdA
+func f1() {}
+`,
+		"f_other.go": `//go:build !linux
+
+package fixture
+
+//#Router CmdB
+func f1() {}
+`,
+	})
+	if strings.Count(output, "有 2 个同名声明") != 1 {
+		t.Fatalf("同名函数的映射应报告一次目标不明确\n%s", output)
+	}
+	if !strings.Contains(output, "映射的函数 f1") || !strings.Contains(output, "f_linux.go:6") || !strings.Contains(output, "f_other.go:6") {
+		t.Fatalf("警告中没有列出全部同名声明\n%s", output)
+	}
+	if strings.Contains(output, "映射的函数 fc") {
+		t.Fatalf("只有一个声明的函数不应报告\n%s", output)
+	}
+}
+
+func TestFuncVarTargets(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+	CmdD
+	CmdE
+	CmdF
+)
+
+type Handler func() string
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#Router CmdA
+var loginHandler = func() string { return "login" }
+
+//#Router CmdB
+var typed func() string = logout
+
+//#Router CmdC
+var inferred = logout
+
+//#Router CmdD
+var named Handler = logout
+
+//#Router CmdE
+var wrong = func(n int) string { return "" }
+
+//#Router CmdF
+var count Cmd
+
+func logout() string { return "logout" }
+
+func main() {
+	fmt.Println(m[CmdA](), m[CmdB](), m[CmdC](), m[CmdD](), len(m))
+}
+`,
+	}
+	sources, output := generateFixtureWith(t, Options{
+		Output:           automationFile,
+		AnnotationPrefix: "[",
+		AnnotationSuffix: "]",
+		GoVersion:        baseGoVersion,
+		PrintDiagnostics: true,
+	}, files)
+	source := sources[automationFile]
+	for _, line := range []string{"m[CmdA] = loginHandler", "m[CmdB] = typed", "m[CmdC] = inferred", "m[CmdD] = named"} {
+		if !strings.Contains(source, line) {
+			t.Fatalf("保存函数的变量应可以作为映射目标，缺少 %s\n%s%s", line, source, output)
+		}
+	}
+	if strings.Contains(source, "wrong") || strings.Contains(source, "count") {
+		t.Fatalf("类型不一致或者不是函数的变量不应生成映射\n%s", source)
+	}
+	if !strings.Contains(output, "#Router 没有找到有效的函数定义") || !strings.Contains(output, "【func(int)(string)】") {
+		t.Fatalf("不是函数的变量应报告没有找到函数定义，类型不一致的变量应报告类型错误\n%s", output)
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "login logout logout logout 4" {
+		t.Errorf("变量映射运行结果不正确: %s", out)
+	}
+}
+
+func TestNewlineOption(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	})
+	file := filepath.Join(dir, automationFile)
+	opts := DefaultOptions()
+	for _, newline := range []string{"\n", "\r\n", "\n"} {
+		opts.Newline = newline
+		var bWritten bool
+		var err error
+		output := captureOutput(t, func() {
+			bWritten, err = WorkOnWith(dir, opts)
+		})
+		if err != nil || !bWritten {
+			t.Fatalf("修改换行符后应重新生成映射文件 %q %v %v\n%s", newline, bWritten, err, output)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := string(data)
+		if !strings.HasSuffix(source, newline) || strings.Count(source, "\n") != strings.Count(source, newline) || (newline == "\n" && strings.Contains(source, "\r")) {
+			t.Fatalf("映射文件没有使用换行符 %q\n%q", newline, source)
+		}
+	}
+}
+
+func TestReflectNew(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Mapping CmdA
+type SSS struct{ N int }
+
+//#MappingPtr CmdB
+type SB struct{}
+
+func main() {
+	p, ok := mm[CmdA].(*SSS)
+	p.N = 1
+	_, isPtr := mm[CmdB].(*SB)
+	fmt.Printf("%T %v %v %d\n", mm[CmdA], ok, isPtr, mm[CmdA].(*SSS).N)
+}
+`,
+	}
+	opts := DefaultOptions()
+	opts.ReflectNew = true
+	sources, output := generateFixtureWith(t, opts, files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "mm[CmdA] = reflect.New(reflect.TypeOf(SSS{})).Interface()") || !strings.Contains(source, "mm[CmdB] = &SB{}") {
+		t.Fatalf("选项ReflectNew应使用反射创建#Mapping 映射的结构\n%s%s", source, output)
+	}
+	if !strings.Contains(source, `import "reflect"`) {
+		t.Fatalf("使用反射创建结构时应导入reflect\n%s", source)
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "*main.SSS true true 1" {
+		t.Errorf("反射创建的结构应是结构指针: %s", out)
+	}
+}
+
+func TestUndefinedKeyType(t *testing.T) {
+	_, output := generateFixtureWith(t, Options{
+		Output:           automationFile,
+		AnnotationPrefix: "[",
+		AnnotationSuffix: "]",
+		GoVersion:        baseGoVersion,
+		PrintDiagnostics: true,
+	}, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cnd]func())
+
+//#Router CmdA
+func fa() {}
+
+//#Router CmdB
+func fb() {}
+`,
+	})
+	if strings.Count(output, "Map key 类型 Cnd 未定义") != 1 {
+		t.Fatalf("key类型未定义时应只报告一次\n%s", output)
+	}
+	if strings.Contains(output, "指定的常量") {
+		t.Fatalf("key类型未定义时不应逐个报告常量\n%s", output)
+	}
+}
+
+func TestMappingStructInit(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#MappingMap
+var mm = make(map[Cmd]interface{})
+
+//#Mapping CmdA CmdC {Retries: 3, Name: "a b"}
+type SSS struct {
+	Retries int
+	Name    string
+}
+
+//#MappingPtr CmdB {Retries: 5}
+type SB struct{ Retries int }
+
+//#Mapping {Retries:
+type SC struct{ Retries int }
+
+func main() {
+	fmt.Println(mm[CmdA].(SSS).Retries, mm[CmdC].(SSS).Name, mm[CmdB].(*SB).Retries)
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	for _, line := range []string{`mm[CmdA] = SSS{Retries: 3, Name: "a b"}`, `mm[CmdC] = SSS{Retries: 3, Name: "a b"}`, "mm[CmdB] = &SB{Retries: 5}"} {
+		if !strings.Contains(source, line) {
+			t.Fatalf("结构映射应使用指定的初始化字段，缺少 %s\n%s%s", line, source, output)
+		}
+	}
+	if !strings.Contains(output, "#Mapping 结构初始化字段 {Retries: 格式错误") {
+		t.Fatalf("格式错误的初始化字段应报告警告\n%s", output)
+	}
+	if out := runFixture(t, files, map[string]string{automationFile: source}); strings.TrimSpace(out) != "3 a b 5" {
+		t.Errorf("初始化字段运行结果不正确: %s", out)
+	}
+}
+
+func TestCommandLine(t *testing.T) {
+	if testing.Short() {
+		t.Skip("short 模式跳过编译运行测试")
+	}
+	goBin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("没有找到 go 命令")
+	}
+	bin := filepath.Join(t.TempDir(), "noterouter")
+	if out, err := exec.Command(goBin, "build", "-tags", "noterouter_noinit", "-o", bin, "./cmd/noterouter").CombinedOutput(); err != nil {
+		t.Fatalf("编译命令行工具失败: %v\n%s", err, out)
+	}
+	//没有使用 noterouter_noinit 编译时拒绝运行
+	noTag := filepath.Join(t.TempDir(), "noterouter")
+	if out, err := exec.Command(goBin, "build", "-o", noTag, "./cmd/noterouter").CombinedOutput(); err != nil {
+		t.Fatalf("编译命令行工具失败: %v\n%s", err, out)
+	}
+	cmd := exec.Command(noTag, "-dir", ".")
+	cmd.Dir = t.TempDir()
+	if out, err := cmd.CombinedOutput(); err == nil || !strings.Contains(string(out), "noterouter_noinit") {
+		t.Fatalf("没有编译标签时应拒绝运行 %v\n%s", err, out)
+	}
+	dir := writeFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+	})
+	noterouter := func(args ...string) (string, string, error) {
+		cmd := exec.Command(bin, args...)
+		//在处理的目录中运行，导入包时的自动处理不应生成默认的映射文件
+		cmd.Dir = dir
+		var stdout, stderr strings.Builder
+		cmd.Stdout, cmd.Stderr = &stdout, &stderr
+		err := cmd.Run()
+		return stdout.String(), stderr.String(), err
+	}
+
+	stdout, stderr, err := noterouter("-dir", ".", "-dry-run")
+	if err != nil || !strings.Contains(stdout, "m[CmdA] = fa") || !strings.Contains(stderr, "映射关系发生变化") {
+		t.Fatalf("-dry-run 应输出生成的代码 %v\n%s%s", err, stdout, stderr)
+	}
+	stdout, stderr, err = noterouter("-dir", dir, "-out", "routes_gen.go")
+	if err != nil || !strings.Contains(stderr, "已更新") {
+		t.Fatalf("生成映射文件失败 %v\n%s%s", err, stdout, stderr)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "routes_gen.go")); err != nil {
+		t.Fatalf("没有生成 -out 指定的映射文件 %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, automationFile)); !os.IsNotExist(err) {
+		t.Fatalf("命令行工具不应在导入包时自动生成映射文件 %v", err)
+	}
+
+	//处理过程中报告了错误时以非0状态退出
+	if err := os.WriteFile(filepath.Join(dir, "b.go"), []byte("package fixture\n\n//#Router CmdA\nfunc fb(n int) {}\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	_, stderr, err = noterouter("-dir", dir, "-out", "routes_gen.go")
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 || !strings.Contains(stderr, "失败") {
+		t.Fatalf("报告错误时应以状态1退出 %v\n%s", err, stderr)
+	}
+}
+
+func TestWorkOnTreeNestedPackages(t *testing.T) {
+	pkg := func(handler string, consts ...string) string {
+		return "package main\n\ntype Cmd int\n\nconst (\n\t" + strings.Join(consts, " Cmd = iota\n\t") + "\n)\n\n//#RouterMap\nvar m = make(map[Cmd]func())\n\n//#Router " + consts[len(consts)-1] + "\nfunc " + handler + "() {}\n\nfunc main() {}\n"
+	}
+	root := writeFixture(t, map[string]string{
+		"a/a.go":   pkg("fa", "CmdA"),
+		"a/b/b.go": pkg("fb", "CmdA", "CmdB"),
+	})
+	var err error
+	output := captureOutput(t, func() {
+		_, err = WorkOnTree(root, DefaultOptions())
+	})
+	if err != nil {
+		t.Fatalf("处理目录树失败 %v\n%s", err, output)
+	}
+	for _, d := range Diagnostics() {
+		if d.Severity != "Note" {
+			t.Errorf("嵌套的同名包不应互相影响: %s", d)
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(root, "a", automationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source := string(data); !strings.Contains(source, "m[CmdA] = fa") || strings.Contains(source, "= fb") {
+		t.Fatalf("目录的映射文件不应包含子目录中的映射\n%s", source)
+	}
+	data, err = os.ReadFile(filepath.Join(root, "a", "b", automationFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if source := string(data); !strings.Contains(source, "m[CmdB] = fb") || strings.Contains(source, "= fa") {
+		t.Fatalf("子目录的映射文件内容不正确\n%s", source)
+	}
+}
+
+func TestPerFileRemovedSource(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#Router CmdA
+func fa() {}
+`,
+		"b.go": `package fixture
+
+//#Router CmdB
+func fb() {}
+`,
+		"NodeRouterAutomation_manual.go": "package fixture\n",
+	})
+	opts := DefaultOptions()
+	opts.PerFile = true
+	work := func() string {
+		return captureOutput(t, func() {
+			if _, err := WorkOnWith(dir, opts); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+	work()
+	if _, err := os.Stat(filepath.Join(dir, "NodeRouterAutomation_b.go")); err != nil {
+		t.Fatalf("没有生成 b.go 的映射文件 %v", err)
+	}
+	//删除源文件后重新生成，删除其映射文件
+	if err := os.Remove(filepath.Join(dir, "b.go")); err != nil {
+		t.Fatal(err)
+	}
+	output := work()
+	if _, err := os.Stat(filepath.Join(dir, "NodeRouterAutomation_b.go")); !os.IsNotExist(err) {
+		t.Fatalf("源文件删除后应删除其映射文件 %v\n%s", err, output)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "NodeRouterAutomation_a.go")); err != nil {
+		t.Fatalf("不应删除仍有映射的文件 %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "NodeRouterAutomation_manual.go")); err != nil {
+		t.Fatalf("不应删除非自动生成的文件 %v", err)
+	}
+	if !strings.Contains(output, "删除映射文件 NodeRouterAutomation_b.go") {
+		t.Fatalf("没有输出删除映射文件的提示\n%s", output)
+	}
+}
+
+func TestRouterSliceTrailingConst(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#RouterSlice
+var handlers []func() string
+
+//#Router CmdA CmdB
+func f() string { return "f" }
+
+func main() {
+	fmt.Println(len(handlers), handlers[CmdC] == nil)
+}
+`,
+	}
+	sources, output := generateFixtureWith(t, DefaultOptions(), files)
+	source := sources[automationFile]
+	if !strings.Contains(source, "CmdC: nil}") {
+		t.Fatalf("切片长度应包含末尾没有映射的常量\n%s%s", source, output)
+	}
+	if !strings.Contains(output, "#RouterSlice handlers 的下标 2 没有映射") {
+		t.Fatalf("末尾没有映射的常量应报告空缺\n%s", output)
+	}
+	if out := runFixture(t, files, sources); strings.TrimSpace(out) != "3 true" {
+		t.Errorf("末尾没有映射的常量分派时应得到nil: %s", out)
+	}
+}
+
+func TestRouterSliceGuardAppendedConst(t *testing.T) {
+	dir := writeFixture(t, map[string]string{
+		"a.go": `package fixture
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdC
+)
+
+//#RouterMap
+var m = make(map[Cmd]func())
+
+//#RouterSlice
+var handlers []func()
+
+//#Router CmdA
+func fa() {}
+`,
+	})
+	generate := func() (bool, string) {
+		var bWritten bool
+		captureOutput(t, func() {
+			var err error
+			if bWritten, err = WorkOn(dir); err != nil {
+				t.Fatal(err)
+			}
+		})
+		data, err := os.ReadFile(filepath.Join(dir, automationFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bWritten, string(data)
+	}
+	_, source := generate()
+	//没有映射的常量也包含在下标检查中
+	for _, want := range []string{"_ = x[CmdA-0]", "_ = x[CmdB-1]", "_ = x[CmdC-2]"} {
+		if !strings.Contains(source, want) {
+			t.Fatalf("缺少切片下标检查 %q\n%s", want, source)
+		}
+	}
+	//在末尾增加常量后重新生成，切片长度与下标检查包含新的常量
+	data, err := os.ReadFile(filepath.Join(dir, "a.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte(strings.Replace(string(data), "\tCmdC\n", "\tCmdC\n\tCmdD\n", 1)), 0666); err != nil {
+		t.Fatal(err)
+	}
+	bWritten, source := generate()
+	if !bWritten || !strings.Contains(source, "CmdD: nil}") || !strings.Contains(source, "_ = x[CmdD-3]") || !strings.Contains(source, "const _ = uint(len([4]struct{}{}) - (int(CmdD) + 1))") {
+		t.Fatalf("末尾增加常量后应重新生成切片与下标检查 %v\n%s", bWritten, source)
+	}
+}
+
+func TestRouterSliceGuardLength(t *testing.T) {
+	files := map[string]string{
+		"main.go": `package main
+
+import "fmt"
+
+type Cmd int
+
+const (
+	CmdA Cmd = iota
+	CmdB
+	CmdLast
+)
+
+//#RouterMap
+var m = make(map[Cmd]func() string)
+
+//#RouterSlice
+var handlers []func() string
+
+//#Router CmdA
+func fa() string { return "a" }
+
+//#Router CmdB
+func fb() string { return "b" }
+
+func main() {
+	fmt.Println(len(handlers), int(CmdLast))
+}
+`,
+	}
+	source, output := generateFixture(t, files)
+	if !strings.Contains(source, "const _ = uint(len([3]struct{}{}) - (int(CmdLast) + 1))") {
+		t.Fatalf("缺少切片长度检查\n%s%s", source, output)
+	}
+	generated := map[string]string{automationFile: source}
+	if out := runFixture(t, files, generated); strings.TrimSpace(out) != "3 2" {
+		t.Errorf("常量未变化时长度检查应通过: %s", out)
+	}
+	//增加常量后没有重新生成，key类型的常量超出切片长度
+	grown := map[string]string{"main.go": strings.Replace(files["main.go"], "\tCmdB\n", "\tCmdB\n\tCmdC\n", 1)}
+	out, err := buildFixture(t, grown, generated)
+	if err == nil || !strings.Contains(out, "overflows uint") {
+		t.Errorf("常量超出切片长度后应编译失败: %v\n%s", err, out)
+	}
+}